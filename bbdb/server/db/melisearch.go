@@ -4,34 +4,167 @@ import (
 	"os"
 	"log"
 	"fmt"
+	"strings"
+	"sync"
 
     "github.com/meilisearch/meilisearch-go"
+    "github.com/redis/go-redis/v9"
 )
 
 func InitMeiliSearch() meilisearch.ServiceManager {
     return meilisearch.New(os.Getenv("MEILI_URL"), meilisearch.WithAPIKey(os.Getenv("MEILI_MASTER_KEY")))
 }
 
-func InitMeilisearchPublic() {
+// Tenant tokens get signed with this key, it never leaves the server. Its uid lives in redis so
+// it's found by that rather than by name, the name is only for when redis has been flushed.
+const (
+	SearchKeyName		= "bbdb-search-tokens"
+	searchKeyUIDKey		= "meili:search_key_uid"
+)
+
+var searchKeyCache struct {
+	sync.Mutex
+	key	*meilisearch.Key
+}
+
+// SearchKey is the key to sign tenant tokens with, made the first time it's needed
+func SearchKey() (*meilisearch.Key, error) {
+	searchKeyCache.Lock()
+	defer searchKeyCache.Unlock()
+
+	// Checked every time so a rotation on another box is picked up straight away
+	uid, err := Rdb.Get(Ctx, searchKeyUIDKey).Result()
+	if searchKeyCache.key != nil && (searchKeyCache.key.UID == uid || (err != nil && err != redis.Nil)) {
+		return searchKeyCache.key, nil // Without redis there's no telling, keep using what we have
+	}
+
 	client := InitMeiliSearch()
-    // Check if key exists, if not create it
-    keys, _ := client.GetKeys(nil)
-    
-    for _, key := range keys.Results {
-        if key.Description == "Search-only key" {
-			fmt.Println(key.Key)
-            return
-        }
-    }
-    
-    key, err := client.CreateKey(&meilisearch.Key{
-		Description: "Search-only key",
-		Actions:     []string{"search"},
-		Indexes:     []string{"*"},
+	var key *meilisearch.Key
+	if uid != "" {
+		key, _ = client.GetKey(uid)
+	}
+	if key == nil {
+		keys, err := client.GetKeys(&meilisearch.KeysQuery{Limit: 1000})
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys.Results {
+			k := &keys.Results[i]
+			if k.Name == SearchKeyName && (key == nil || k.CreatedAt.After(key.CreatedAt)) {
+				key = k
+			}
+		}
+	}
+	if key == nil {
+		if key, err = createSearchKey(client); err != nil {
+			return nil, err
+		}
+	}
+
+	Rdb.Set(Ctx, searchKeyUIDKey, key.UID, 0)
+	searchKeyCache.key = key
+	return key, nil
+}
+
+func createSearchKey(client meilisearch.ServiceManager) (*meilisearch.Key, error) {
+	return client.CreateKey(&meilisearch.Key{
+		Name:			SearchKeyName,
+		Description:	"Signs the short lived search tokens the API hands out",
+		Actions:		[]string{"search"},
+		Indexes:		[]string{ItemsIndex},
 	})
+}
+
+// RotateSearchKeys makes a new signing key and deletes every other search-only key, the old
+// signing keys and the permanent public ones from before tokens alike. Tokens signed with
+// the old key stop working right away, the front end just fetches a new one.
+func RotateSearchKeys() error {
+	client := InitMeiliSearch()
+	key, err := createSearchKey(client)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	if err := Rdb.Set(Ctx, searchKeyUIDKey, key.UID, 0).Err(); err != nil {
+		return fmt.Errorf("made key %s but could not save it to redis, nothing revoked: %w", key.UID, err)
+	}
+	log.Printf("New search key %s", key.UID)
 
-	fmt.Println("API Key:", key.Key)
-}
\ No newline at end of file
+	keys, err := client.GetKeys(&meilisearch.KeysQuery{Limit: 1000})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys.Results {
+		if k.UID == key.UID || len(k.Actions) != 1 || k.Actions[0] != "search" {
+			continue
+		}
+		if _, err := client.DeleteKey(k.UID); err != nil {
+			return fmt.Errorf("could not revoke %s: %w", k.UID, err)
+		}
+		log.Printf("Revoked %s (%s)", k.UID, strings.TrimSpace(k.Name+" "+k.Description))
+	}
+	return nil
+}
+
+// The items index has one document per variant, keyed on variant_id
+const ItemsIndex = "items"
+
+var (
+	ItemsSearchable = []string{"title", "variant", "developer", "publisher", "platform", "description", "contributed_by"}
+	// What the front end shows counts for, everything here can be filtered on too
+	ItemsFacets = []string{"platform", "box_type", "region", "year", "developer", "publisher", "colors"}
+	ItemsFilterable = append([]string{"contributed_by", "contributor_id", "game_id"}, ItemsFacets...)
+	ItemsSortable = []string{"title", "year", "created_at"}
+
+	// Collectors call things by more than one name, mostly platforms and publishers
+	ItemsSynonyms = map[string][]string{
+		"dos":				{"ms-dos", "pc"},
+		"ms-dos":			{"dos"},
+		"pc":				{"dos", "windows"},
+		"win":				{"windows"},
+		"windows":			{"win", "pc"},
+		"mac":				{"macintosh"},
+		"macintosh":		{"mac"},
+		"c64":				{"commodore 64"},
+		"commodore 64":		{"c64"},
+		"amiga":			{"commodore amiga"},
+		"ea":				{"electronic arts"},
+		"electronic arts":	{"ea"},
+		"ssi":				{"strategic simulations"},
+		"strategic simulations":	{"ssi"},
+		"lucasarts":		{"lucasfilm games"},
+		"lucasfilm games":	{"lucasarts"},
+		"microprose":		{"micro prose"},
+		"sierra":			{"sierra on-line"},
+		"bigbox":			{"big box"},
+		"big box":			{"bigbox"},
+	}
+)
+
+// ConfigureItemsIndex creates the items index if it isn't there and sets what's searchable,
+// filterable, sortable and faceted. Safe to run again whenever these change.
+func ConfigureItemsIndex() error {
+	client := InitMeiliSearch()
+	if _, err := client.CreateIndex(&meilisearch.IndexConfig{Uid: ItemsIndex, PrimaryKey: "variant_id"}); err != nil {
+		return err
+	}
+	return ConfigureIndex(ItemsIndex)
+}
+
+// ConfigureIndex puts the items settings on an index, reindex uses it on the one it's filling
+func ConfigureIndex(uid string) error {
+	task, err := InitMeiliSearch().Index(uid).UpdateSettings(&meilisearch.Settings{
+		SearchableAttributes:	ItemsSearchable,
+		FilterableAttributes:	ItemsFilterable,
+		SortableAttributes:		ItemsSortable,
+		Synonyms:				ItemsSynonyms,
+		Faceting: &meilisearch.Faceting{
+			MaxValuesPerFacet:	500,
+			SortFacetValuesBy:	map[string]meilisearch.SortFacetType{"*": meilisearch.SortFacetTypeCount},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not configure %s: %w", uid, err)
+	}
+	log.Printf("Configuring %s (task %d)", uid, task.TaskUID)
+	return nil
+}
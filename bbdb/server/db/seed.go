@@ -43,6 +43,32 @@ func RunAllSeeds(db *gorm.DB) error {
         return err
     }
 
+    if err := RunSeedOnce(db, "seed_v3_box_type_shapes", func(tx *gorm.DB) error {
+		log.Println("No record of seed_v3_box_type_shapes seed, running...")
+		seedsRan += 1
+        return seedv3BoxTypeShapes(tx)
+    }); err != nil {
+        return err
+    }
+
+    // Right flaps and vinyl double gatefolds got their own geometry
+    if err := RunSeedOnce(db, "seed_v4_box_type_gatefolds", func(tx *gorm.DB) error {
+		log.Println("No record of seed_v4_box_type_gatefolds seed, running...")
+		seedsRan += 1
+        return seedBoxTypeShapes(tx, 16, 20)
+    }); err != nil {
+        return err
+    }
+
+    // Jewel cases and keep cases got their own models
+    if err := RunSeedOnce(db, "seed_v5_box_type_cases", func(tx *gorm.DB) error {
+		log.Println("No record of seed_v5_box_type_cases seed, running...")
+		seedsRan += 1
+        return seedBoxTypeShapes(tx, 4, 22)
+    }); err != nil {
+        return err
+    }
+
 	if(seedsRan > 0){
 		log.Println(fmt.Sprintf("%d Seeds ran!", seedsRan))
 	}
@@ -72,6 +98,47 @@ func seedv2BoxTypes(db *gorm.DB) error {
     return nil
 }
 
+// Fills in shape/gatefold definitions for box types that were seeded before they existed
+func seedv3BoxTypeShapes(db *gorm.DB) error {
+    for _, bt := range models.BoxtypesEnum {
+        if err := upsertBoxTypeShape(db, bt); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Same thing for just the box types a later seed changed, so it doesn't stomp on rows it didn't touch
+func seedBoxTypeShapes(db *gorm.DB, ids ...uint) error {
+    for _, id := range ids {
+        bt := models.FindBoxType(id)
+        if bt == nil {
+            return fmt.Errorf("no box type %d to seed", id)
+        }
+        if err := upsertBoxTypeShape(db, *bt); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func upsertBoxTypeShape(db *gorm.DB, bt models.BoxType) error {
+    return db.
+        Where("id = ?", bt.ID).
+        Assign(models.BoxType{
+            Width: bt.Width,
+            Height: bt.Height,
+            Depth: bt.Depth,
+            Shape: bt.Shape,
+            TopWidthRatio: bt.TopWidthRatio,
+            GatefoldLayout: bt.GatefoldLayout,
+            GatefoldHinge: bt.GatefoldHinge,
+            FaceRotation: bt.FaceRotation,
+            ShelfDirection: bt.ShelfDirection,
+        }).
+        FirstOrCreate(&bt).Error
+}
+
 func seedInitialUsers(db *gorm.DB) error {
     users := []models.User{
         {Name: os.Getenv("BBDB_ADMIN_NAME"), ApiKey: uniuri.NewLen(24)},
@@ -17,7 +17,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gosimple/slug"
 	"gorm.io/gorm/clause"
-	"github.com/meilisearch/meilisearch-go"
 	"github.com/dchest/uniuri"
 	"github.com/Henry-Sarabia/igdb/v2"
 
@@ -45,6 +44,12 @@ var allowedFiles = []string{
 	"gatefold_back_right.tif",
 	"gatefold_front_left.tif", 
 	"gatefold_front_right.tif",
+	"gatefold_front_left_back.tif",
+	"gatefold_front_right_back.tif",
+	"gatefold_top.tif",
+	"gatefold_bottom.tif",
+	"gatefold_inner_front.tif",
+	"gatefold_inner_back.tif",
 	"back.webp", 
 	"bottom.webp", 
 	"front.webp", 
@@ -57,10 +62,32 @@ var allowedFiles = []string{
 	"gatefold_back_right.webp",
 	"gatefold_front_left.webp", 
 	"gatefold_front_right.webp",
+	"gatefold_front_left_back.webp",
+	"gatefold_front_right_back.webp",
+	"gatefold_top.webp",
+	"gatefold_bottom.webp",
+	"gatefold_inner_front.webp",
+	"gatefold_inner_back.webp",
+}
+
+// Every scan can bring surface maps along with it, e.g. front_normal.tif or gatefold_left_mask.webp
+func init() {
+	for _, f := range slices.Clone(allowedFiles) {
+		ext := filepath.Ext(f)
+		if ext != ".tif" && ext != ".webp" {
+			continue
+		}
+		for _, kind := range tools.SurfaceMapKinds {
+			allowedFiles = append(allowedFiles, strings.TrimSuffix(f, ext)+"_"+kind+ext)
+		}
+	}
 }
 
 var igdbClient = bbdbigdb.NewClient()
 
+// Things that came in the box live in their own folders, items/<name>/
+const itemsDir = "items/"
+
 // Testing curl - curl -H "Authorization: Bearer {some key}" -X PUT http://localhost:8080/api/admin/import -F "file=@./testbox.zip" -H "Content-Type: multipart/form-data"
 func AdminImport(c *gin.Context){
 	file, err := c.FormFile("file")
@@ -163,18 +190,23 @@ func (d *DirectorySource) ReadJSON(filename string) ([]byte, error) {
 }
 
 func (d *DirectorySource) ListFiles() ([]string, error) {
-	entries, err := os.ReadDir(d.path)
-	if err != nil {
-		return nil, err
-	}
-	
 	var files []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			files = append(files, entry.Name())
+	err := filepath.WalkDir(d.path, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-	}
-	return files, nil
+		if entry.IsDir() {
+			return nil
+		}
+		// Same slash separated paths a zip would give us, so items/<name>/ works either way
+		rel, err := filepath.Rel(d.path, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
 }
 
 func (d *DirectorySource) GetFilePath(filename string) (string, bool, error) {
@@ -199,7 +231,6 @@ func ImportFromSource(source FileSource) error {
 	}
 
 	database := db.GetDB()
-	meili := db.InitMeiliSearch()
 	slugTitle := slug.Make(data.Title)
 	variantDesc := data.Variant
 
@@ -207,6 +238,36 @@ func ImportFromSource(source FileSource) error {
 		data.BoxType++
 	}
 
+	var boxType models.BoxType
+	if err := database.First(&boxType, data.BoxType).Error; err != nil {
+		return fmt.Errorf("unknown box type %d: %w", data.BoxType, err)
+	}
+
+	// Fall back to the box type's standard size for anything not measured
+	if data.Width == 0 && boxType.Width != nil {
+		data.Width = *boxType.Width
+	}
+	if data.Height == 0 && boxType.Height != nil {
+		data.Height = *boxType.Height
+	}
+	if data.Depth == 0 && boxType.Depth != nil {
+		data.Depth = *boxType.Depth
+	}
+
+	// Slugs only catch the same title and description, the scans catch the rest
+	variantSlug := slug.Make(fmt.Sprintf("%s-%s-%d", slugTitle, variantDesc, data.BoxType))
+	frontHash, backHash := importHashes(source, &data)
+	if dups := findDuplicates(frontHash, backHash, variantSlug); len(dups) > 0 {
+		var names []string
+		for _, d := range dups {
+			names = append(names, fmt.Sprintf("%s (%d)", d.Game.Title, d.ID))
+		}
+		if data.AllowDuplicate == nil || !*data.AllowDuplicate {
+			return fmt.Errorf("scans look like %s already, set allow_duplicate in info.json to import anyway", strings.Join(names, ", "))
+		}
+		log.Printf("Importing anyway, scans look like %s", strings.Join(names, ", "))
+	}
+
 	userName := os.Getenv("BBDB_ADMIN_NAME")
 	if data.ContributedBy != nil {
 		userName = *data.ContributedBy
@@ -296,7 +357,7 @@ func ImportFromSource(source FileSource) error {
 		BoxTypeID:   data.BoxType,
 		Description: variantDesc,
 		GatefoldTransparent: gatefoldTransparent,
-		Slug:        slug.Make(fmt.Sprintf("%s-%s-%d", slugTitle, variantDesc, data.BoxType)), // do I need this?
+		Slug:        variantSlug, // do I need this?
 		DeveloperID: dev.ID,
 		PublisherID: pub.ID,
 		RegionID:    region.ID,
@@ -304,11 +365,13 @@ func ImportFromSource(source FileSource) error {
 		Height:      data.Height,
 		Depth:       data.Depth,
 		UserID:      user.ID,
+		FrontHash:   frontHash,
+		BackHash:    backHash,
 	}
 
 	database.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "slug"}},
-		DoUpdates: clause.AssignmentColumns([]string{"year", "description","width","height","depth","gatefold_transparent"}),
+		DoUpdates: clause.AssignmentColumns([]string{"year", "description","width","height","depth","gatefold_transparent","front_hash","back_hash"}),
 	}).Create(&variant)
 
 	variantID := variant.ID
@@ -318,23 +381,7 @@ func ImportFromSource(source FileSource) error {
 		variantID = variant.ID
 	}
 
-	docs := []map[string]interface{}{
-		{
-			"id":   game.ID,
-			"slug": game.Slug,
-			"variant_id": variantID,
-			"title": game.Title,
-			"year": variant.Year,
-			"region":region.Name,
-		},
-	}
-	pk := "variant_id"
-	meili.Index("items").AddDocuments(docs, &meilisearch.DocumentOptions{
-		PrimaryKey: &pk,
-	})
-
 	// Process images
-	var texPaths []string
 	wd, err := os.Getwd()
 	gameDir := filepath.Join(wd, "uploads/scans", slugTitle, strconv.Itoa(int(variantID)))
 	os.MkdirAll(gameDir, os.ModePerm)
@@ -344,15 +391,27 @@ func ImportFromSource(source FileSource) error {
 		return fmt.Errorf("failed to list files: %w", err)
 	}
 
-	foundBox := false
 	tmpDir, err := os.MkdirTemp("/tmp", "upload-"+slugTitle+"-"+strconv.Itoa(int(variantID)))
 
 	// Ensure cleanup happens no matter what
 	defer os.RemoveAll(tmpDir)
 
+	var itemFiles, manualFiles []string
 	for _, filename := range files {
-		if !slices.Contains(allowedFiles, filename) {
-			return fmt.Errorf("failed to approve " + filename)
+		if strings.HasPrefix(filename, itemsDir) {
+			itemFiles = append(itemFiles, filename)
+			continue
+		}
+		if strings.HasPrefix(filename, tools.ManualDir+"/") {
+			if !tools.IsManualPage(filename) {
+				return fmt.Errorf("failed to approve %s", filename)
+			}
+			manualFiles = append(manualFiles, filename)
+			continue
+		}
+
+		if !slices.Contains(allowedFiles, filename) && !slices.Contains(tools.CalibrationFiles, filename) {
+			return fmt.Errorf("failed to approve %s", filename)
 		}
 
 		srcPath, _, err := source.GetFilePath(filename)
@@ -370,34 +429,43 @@ func ImportFromSource(source FileSource) error {
 		return fmt.Errorf("failed to read temp dir: %w", err)
 	}
 
+	var scans []string
+	var cal *tools.ColorCalibration
 	for _, entry := range entries {
-		filename := entry.Name()
-	    srcPath := filepath.Join(tmpDir, filename)
-
-		if filename == "info.json" {
+		p := filepath.Join(tmpDir, entry.Name())
+		if !slices.Contains(tools.CalibrationFiles, entry.Name()) {
+			scans = append(scans, p)
 			continue
 		}
+		if cal, err = tools.LoadCalibration(p); err != nil {
+			return fmt.Errorf("failed to calibrate: %w", err)
+		}
+		log.Printf("Color calibration: mean error %.1f -> %.1f", cal.Before, cal.After)
+	}
 
-		dstPath := tmpDir+"/"+filename
-		dstPath = strings.ReplaceAll(dstPath, ".tif", ".webp")
+	// Has to be read before deskewing, that converts them to sRGB
+	scanProfile := scanProfiles(scans)
 
-		if err := tools.ProcessImage(srcPath, dstPath, filename, data.Width, data.Height, data.Depth); err != nil {
-			return fmt.Errorf("failed to process image: " + err.Error())
+	if data.Deskew != nil && *data.Deskew {
+		warnings, err := tools.DeskewScans(scans, data.Width, data.Height, data.Depth)
+		if err != nil {
+			return fmt.Errorf("failed to deskew scans: %w", err)
 		}
-
-		if filename == "front.webp" {
-			tools.Copy(dstPath,gameDir + "/" + filepath.Base(dstPath))
+		for _, w := range warnings {
+			log.Println("Deskew:", w)
 		}
-		
-		texPaths = append(texPaths, dstPath)
+	}
 
-		// If we already have glb files, use em!
-		if filename == "box.glb" || filename == "box-low.glb" {
-			foundBox = true
-			tools.Copy(srcPath,gameDir + "/" + filename)
-		}
+	texPaths, foundBox, err := processScans(entries, tmpDir, gameDir, fmt.Sprintf("/scans/%s/%d/%s", slugTitle, variantID, tools.FacesDir), &data, cal)
+	if err != nil {
+		return err
 	}
 
+	database.Model(&models.Variant{}).Where("id = ?", variantID).Updates(map[string]interface{}{
+		"scan_profile": scanProfile,
+		"color_calibrated": cal != nil,
+	})
+
 	if !foundBox {
 
 		gameInfo := &tools.GameInfo{
@@ -406,28 +474,363 @@ func ImportFromSource(source FileSource) error {
 			Height:  data.Height,
 			Depth:   data.Depth,
 			BoxType: data.BoxType,
+			BoxTypeDef: &boxType,
+			GatefoldTransparent: gatefoldTransparent,
 		}
 	
 		if os.Getenv("APP_ENV") != "production" {
 			log.Println("Making glb file")
 		}
 		if err := tools.GenerateGLTFBox(gameInfo, texPaths, tmpDir, false); err != nil {
-			return fmt.Errorf("failed to process glb file: " + err.Error())
+			return fmt.Errorf("failed to process glb file: %w", err)
 		}
 		tools.Copy(tmpDir + "/box.glb",gameDir + "/box.glb")
+		for _, derived := range tools.DerivedFiles {
+			if _, err := os.Stat(tmpDir + "/" + derived); err == nil {
+				tools.Copy(tmpDir + "/" + derived, gameDir + "/" + derived)
+			}
+		}
 		if os.Getenv("APP_ENV") != "production" {
 			log.Println("Making low glb file")
 		}
 		if err := tools.GenerateGLTFBox(gameInfo, texPaths, tmpDir, true); err != nil {
-			return fmt.Errorf("failed to process glb file: " + err.Error())
+			return fmt.Errorf("failed to process glb file: %w", err)
 		}
 		tools.Copy(tmpDir + "/box-low.glb",gameDir + "/box-low.glb")
+
+		// Hang onto the faces so rebuild-assets can make these again later
+		if err := archiveSources(texPaths, slugTitle, variantID); err != nil {
+			log.Println("Could not archive source faces:", err)
+		}
+	}
+
+	if err := importItems(source, itemFiles, tmpDir, gameDir, variantID, cal); err != nil {
+		return err
+	}
+
+	// After the items, so a scanned page sequence wins over an items/manual/ folder
+	if err := importManual(source, manualFiles, &data, tmpDir, gameDir, slugTitle, variantID, cal); err != nil {
+		return err
 	}
 
 	if err := tools.OptimizeWebPImages([]string{gameDir+"/front.webp"}, data.Width, data.Height); err != nil{
-		fmt.Errorf("Could not optimize image folder")
+		log.Println("Could not optimize image folder:", err)
+	}
+
+	if err := savePalette(variantID, gameDir); err != nil {
+		log.Println("Could not extract palette:", err)
+	}
+
+	if err := indexVariant(variantID); err != nil {
+		log.Println("Could not update search:", err)
+	}
+
+	InvalidateImageIndex()
+
+	return nil
+}
+
+// processScans turns the staged scans into the textures the box gets built from, along with every
+// size of each face. Prebuilt glbs get copied over as they are and foundBox says there were some.
+func processScans(entries []os.DirEntry, tmpDir, gameDir, facesURL string, data *tools.ImportData, cal *tools.ColorCalibration) (texPaths []string, foundBox bool, err error) {
+	facesDir := filepath.Join(gameDir, tools.FacesDir)
+	os.RemoveAll(facesDir)
+	var faces []*tools.FaceImages
+
+	for _, entry := range entries {
+		filename := entry.Name()
+	    srcPath := filepath.Join(tmpDir, filename)
+
+		if filename == "info.json" || slices.Contains(tools.CalibrationFiles, filename) {
+			continue
+		}
+
+		// If we already have glb files, use em! They're not images, so straight over as they are
+		if filename == "box.glb" || filename == "box-low.glb" {
+			foundBox = true
+			if _, err := tools.Copy(srcPath, filepath.Join(gameDir, filename)); err != nil {
+				return nil, false, fmt.Errorf("failed to copy %s: %w", filename, err)
+			}
+			continue
+		}
+
+		// Every size of the outside and gatefold faces, straight from the scan before
+		// ProcessImage shrinks it (in place for .webp)
+		if ext := filepath.Ext(filename); (ext == ".tif" || ext == ".webp") && !tools.IsSurfaceMap(filename) {
+			face, err := tools.MakeFaceImages(srcPath, facesDir, facesURL, cal)
+			if err != nil {
+				log.Println("Could not make face images:", err)
+			} else {
+				faces = append(faces, face)
+			}
+		}
+
+		dstPath := tmpDir+"/"+filename
+		dstPath = strings.ReplaceAll(dstPath, ".tif", ".webp")
+
+		if err := tools.ProcessImage(srcPath, dstPath, filename, data.Width, data.Height, data.Depth, cal); err != nil {
+			return nil, false, fmt.Errorf("failed to process image: %w", err)
+		}
+
+		if filename == "front.webp" {
+			tools.Copy(dstPath,gameDir + "/" + filepath.Base(dstPath))
+		}
+		
+		texPaths = append(texPaths, dstPath)
+	}
+
+	if len(faces) > 0 {
+		if err := tools.WriteFaceManifest(faces, facesDir); err != nil {
+			log.Println("Could not write face manifest:", err)
+		}
+	}
+
+	return texPaths, foundBox, nil
+}
+
+// scanProfiles names the ICC profiles the box scans came in with, nil if none had one.
+// Surface maps don't count, whatever profile they carry isn't used.
+func scanProfiles(paths []string) *string {
+	var names []string
+	for _, p := range paths {
+		if tools.IsSurfaceMap(p) {
+			continue
+		}
+		profile, err := tools.ReadICCProfile(p)
+		if err != nil || profile == nil {
+			continue
+		}
+		name := profile.Description
+		if name == "" {
+			name = "Unnamed " + profile.ColorSpace + " profile"
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	joined := strings.Join(names, ", ")
+	return &joined
+}
+
+// Item folders can only hold their info.json, front/back scans and manual pages
+func itemFileAllowed(filename string) bool {
+	if filename == "info.json" {
+		return true
+	}
+	ext := filepath.Ext(filename)
+	if ext != ".tif" && ext != ".webp" {
+		return false
+	}
+	stem := strings.TrimSuffix(filename, ext)
+	if stem == "front" || stem == "back" {
+		return true
+	}
+	_, ok := tools.ItemPageNumber(filename)
+	return ok
+}
+
+// importItems builds a glb for everything in items/ and saves them against the variant
+func importItems(source FileSource, files []string, tmpDir, gameDir string, variantID uint, cal *tools.ColorCalibration) error {
+	if len(files) == 0 {
+		return pruneItems(variantID, gameDir, nil)
+	}
+
+	// items/<name>/<file>, nothing deeper
+	folders := make(map[string][]string)
+	for _, f := range files {
+		parts := strings.Split(strings.TrimPrefix(f, itemsDir), "/")
+		if len(parts) != 2 || !itemFileAllowed(parts[1]) {
+			return fmt.Errorf("failed to approve %s", f)
+		}
+		folders[parts[0]] = append(folders[parts[0]], parts[1])
+	}
+
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	database := db.GetDB()
+	os.MkdirAll(filepath.Join(gameDir, "items"), os.ModePerm)
+
+	slugs := make([]string, 0, len(names))
+	for i, name := range names {
+		jsonData, err := source.ReadJSON(itemsDir + name + "/info.json")
+		if err != nil {
+			return fmt.Errorf("item %s has no info.json: %w", name, err)
+		}
+
+		var item tools.ImportItemData
+		if err := json.Unmarshal(jsonData, &item); err != nil {
+			return fmt.Errorf("invalid JSON for item %s: %w", name, err)
+		}
+
+		defaults, ok := models.ItemKindDefaults[item.Kind]
+		if !ok {
+			return fmt.Errorf("unknown item kind '%s' for item %s", item.Kind, name)
+		}
+		if item.Width == 0 {
+			item.Width = defaults[0]
+		}
+		if item.Height == 0 {
+			item.Height = defaults[1]
+		}
+		if item.Depth == 0 {
+			item.Depth = defaults[2]
+		}
+		if item.Name == "" {
+			item.Name = name
+		}
+		sortOrder := i
+		if item.Sort != nil {
+			sortOrder = *item.Sort
+		}
+
+		itemSlug := slug.Make(name)
+		slugs = append(slugs, itemSlug)
+		itemDir := filepath.Join(tmpDir, "items", itemSlug)
+		os.MkdirAll(itemDir, os.ModePerm)
+
+		var texPaths []string
+		pages := 0
+		for _, filename := range folders[name] {
+			if filename == "info.json" {
+				continue
+			}
+
+			srcPath, _, err := source.GetFilePath(itemsDir + name + "/" + filename)
+			if err != nil {
+				return fmt.Errorf("failed to get file: %w", err)
+			}
+
+			dstPath := filepath.Join(itemDir, strings.ReplaceAll(filename, ".tif", ".webp"))
+			if err := tools.ProcessImage(srcPath, dstPath, filename, item.Width, item.Height, item.Depth, cal); err != nil {
+				return fmt.Errorf("failed to process image: %w", err)
+			}
+			texPaths = append(texPaths, dstPath)
+
+			if _, ok := tools.ItemPageNumber(filename); ok && item.Kind == models.ItemManual {
+				pages++
+			}
+		}
+
+		if os.Getenv("APP_ENV") != "production" {
+			log.Println("Making glb file for item", name)
+		}
+		if err := tools.GenerateItemGLB(&item, texPaths, itemDir); err != nil {
+			return fmt.Errorf("failed to process glb for item %s: %w", name, err)
+		}
+		tools.Copy(filepath.Join(itemDir, "item.glb"), filepath.Join(gameDir, "items", itemSlug+".glb"))
+
+		variantItem := models.VariantItem{
+			VariantID:	variantID,
+			Slug:		itemSlug,
+			Kind:		item.Kind,
+			Name:		item.Name,
+			Width:		item.Width,
+			Height:		item.Height,
+			Depth:		item.Depth,
+			Pages:		pages,
+			SortOrder:	sortOrder,
+		}
+
+		database.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "variant_id"}, {Name: "slug"}},
+			DoUpdates: clause.AssignmentColumns([]string{"kind", "name", "width", "height", "depth", "pages", "sort_order"}),
+		}).Create(&variantItem)
+	}
+
+	return pruneItems(variantID, gameDir, slugs)
+}
+
+// pruneItems drops whatever a re-import didn't bring along again, rows and glbs both
+func pruneItems(variantID uint, gameDir string, keep []string) error {
+	q := db.GetDB().Where("variant_id = ?", variantID)
+	if len(keep) > 0 {
+		q = q.Where("slug NOT IN ?", keep)
+	}
+	var stale []models.VariantItem
+	if err := q.Find(&stale).Error; err != nil {
+		return fmt.Errorf("failed to look up old items: %w", err)
+	}
+
+	for _, item := range stale {
+		if err := db.GetDB().Delete(&item).Error; err != nil {
+			return fmt.Errorf("failed to delete item %s: %w", item.Slug, err)
+		}
+		if err := os.Remove(filepath.Join(gameDir, "items", item.Slug+".glb")); err != nil && !os.IsNotExist(err) {
+			log.Printf("Could not delete %s.glb: %v", item.Slug, err)
+		}
+	}
+	return nil
+}
+
+// importManual builds the paged viewer assets for a manual/NNN.tif page sequence
+func importManual(source FileSource, files []string, data *tools.ImportData, tmpDir, gameDir, slugTitle string, variantID uint, cal *tools.ColorCalibration) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	stageDir := filepath.Join(tmpDir, tools.ManualDir)
+	os.MkdirAll(stageDir, os.ModePerm)
+
+	var pagePaths []string
+	for _, f := range files {
+		srcPath, _, err := source.GetFilePath(f)
+		if err != nil {
+			return fmt.Errorf("failed to get file: %w", err)
+		}
+		dstPath := filepath.Join(stageDir, filepath.Base(f))
+		if _, err := tools.Copy(srcPath, dstPath); err != nil {
+			return fmt.Errorf("failed to stage file: %w", err)
+		}
+		pagePaths = append(pagePaths, dstPath)
+	}
+
+	opts := tools.ManualOptions{
+		Title:	data.Title + " Manual",
+		PDF:	data.ManualPDF == nil || *data.ManualPDF,
+		Calibration:	cal,
+	}
+	urlPrefix := fmt.Sprintf("/scans/%s/%d", slugTitle, variantID)
+	if data.ManualModel == nil || *data.ManualModel {
+		os.MkdirAll(filepath.Join(gameDir, "items"), os.ModePerm)
+		opts.ModelPath = filepath.Join(gameDir, "items", tools.ManualDir+".glb")
+		opts.ModelURL = urlPrefix + "/items/" + tools.ManualDir + ".glb"
+	}
+
+	if os.Getenv("APP_ENV") != "production" {
+		log.Printf("Building manual from %d pages", len(pagePaths))
+	}
+	manifest, err := tools.BuildManual(pagePaths, filepath.Join(gameDir, tools.ManualDir), urlPrefix+"/"+tools.ManualDir, opts)
+	if err != nil {
+		return fmt.Errorf("failed to build manual: %w", err)
+	}
+
+	// The booklet shows up with the rest of the box contents
+	if manifest.Model != "" {
+		defaults := models.ItemKindDefaults[models.ItemManual]
+		variantItem := models.VariantItem{
+			VariantID:	variantID,
+			Slug:		tools.ManualDir,
+			Kind:		models.ItemManual,
+			Name:		"Manual",
+			Width:		defaults[0],
+			Height:		defaults[1],
+			Depth:		defaults[2],
+			Pages:		max(0, len(manifest.Pages)-2), // Inside pages, the covers don't count
+		}
+		db.GetDB().Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "variant_id"}, {Name: "slug"}},
+			DoUpdates: clause.AssignmentColumns([]string{"kind", "name", "pages"}),
+		}).Create(&variantItem)
 	}
 
+	db.Invalidate(fmt.Sprintf("variant:%d:manual", variantID))
 	return nil
 }
 
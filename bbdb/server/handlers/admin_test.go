@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+// Packages can ship their own glbs, those aren't images and have to come through untouched
+func TestProcessScansPrebuiltGLB(t *testing.T) {
+	glb := append([]byte("glTF\x02\x00\x00\x00"), bytes.Repeat([]byte{0xab}, 64)...)
+
+	cases := []struct {
+		name  string
+		files []string
+	}{
+		{"both glbs", []string{"info.json", "box.glb", "box-low.glb"}},
+		{"just box.glb", []string{"info.json", "box.glb"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpDir, gameDir := t.TempDir(), t.TempDir()
+			for _, f := range c.files {
+				if err := os.WriteFile(filepath.Join(tmpDir, f), glb, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries, err := os.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := &tools.ImportData{Width: 7.5, Height: 9.25, Depth: 2}
+			texPaths, foundBox, err := processScans(entries, tmpDir, gameDir, "/scans/test/1/faces", data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !foundBox {
+				t.Error("didn't notice the prebuilt glb")
+			}
+			if len(texPaths) != 0 {
+				t.Errorf("glbs ended up as textures: %v", texPaths)
+			}
+
+			for _, f := range c.files {
+				if f == "info.json" {
+					continue
+				}
+				got, err := os.ReadFile(filepath.Join(gameDir, f))
+				if err != nil {
+					t.Fatalf("%s wasn't copied over: %v", f, err)
+				}
+				if !bytes.Equal(got, glb) {
+					t.Errorf("%s changed on the way over", f)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+type DuplicateVariant struct {
+	ID			uint	`json:"id"`
+	Title		string	`json:"title"`
+	Slug		string	`json:"slug"`
+	Variant		string	`json:"variant"`
+	Distance	int		`json:"distance"` // Bits off from the first variant in the cluster
+}
+
+// hashesMatch says whether two variants look like the same box. Both fronts have to be close,
+// and the backs too when both have one. Returns the worse of the two distances.
+func hashesMatch(aFront, aBack, bFront, bBack *uint64, threshold int) (int, bool) {
+	if aFront == nil || bFront == nil {
+		return 0, false
+	}
+	dist := tools.HashDistance(*aFront, *bFront)
+	if aBack != nil && bBack != nil {
+		dist = max(dist, tools.HashDistance(*aBack, *bBack))
+	}
+	return dist, dist <= threshold
+}
+
+// importHashes hashes the front and back scans of an import, nil for any it doesn't have
+func importHashes(source FileSource, data *tools.ImportData) (front, back *uint64) {
+	deskew := data.Deskew != nil && *data.Deskew
+	hash := func(face string) *uint64 {
+		for _, ext := range []string{".tif", ".webp"} {
+			path, isTemp, err := source.GetFilePath(face + ext)
+			if err != nil {
+				continue
+			}
+			if isTemp {
+				defer os.Remove(path)
+			}
+			h, err := tools.HashScan(path, deskew)
+			if err != nil {
+				log.Printf("Could not hash %s%s: %v", face, ext, err)
+				return nil
+			}
+			return &h
+		}
+		return nil
+	}
+	return hash("front"), hash("back")
+}
+
+// findDuplicates lists the variants that hash like an import, other than the one it would update
+func findDuplicates(front, back *uint64, variantSlug string) []models.Variant {
+	if front == nil {
+		return nil
+	}
+
+	var variants []models.Variant
+	db.GetDB().Preload("Game").Where("front_hash IS NOT NULL AND slug <> ?", variantSlug).Find(&variants)
+
+	var dups []models.Variant
+	for _, v := range variants {
+		if _, ok := hashesMatch(front, back, v.FrontHash, v.BackHash, tools.DuplicateHashDistance); ok {
+			dups = append(dups, v)
+		}
+	}
+	return dups
+}
+
+// AdminDuplicates groups every variant that looks like another into clusters, ?distance= to loosen or tighten it
+func AdminDuplicates(c *gin.Context) {
+	threshold := tools.DuplicateHashDistance
+	if d, err := strconv.Atoi(c.Query("distance")); err == nil && d >= 0 {
+		threshold = d
+	}
+
+	var variants []models.Variant
+	if err := db.GetDB().Preload("Game").Preload("BoxType").Where("front_hash IS NOT NULL").Order("id").Find(&variants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Union find, so A~B and B~C end up together even if A and C are a bit further apart
+	parent := make([]int, len(variants))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range variants {
+		for j := i + 1; j < len(variants); j++ {
+			a, b := &variants[i], &variants[j]
+			if _, ok := hashesMatch(a.FrontHash, a.BackHash, b.FrontHash, b.BackHash, threshold); ok {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range variants {
+		groups[find(i)] = append(groups[find(i)], i)
+	}
+
+	clusters := [][]DuplicateVariant{}
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		first := &variants[members[0]]
+		var cluster []DuplicateVariant
+		for _, i := range members {
+			v := &variants[i]
+			dist, _ := hashesMatch(first.FrontHash, first.BackHash, v.FrontHash, v.BackHash, threshold)
+			desc := v.BoxType.Name
+			if v.Description != "" {
+				desc = fmt.Sprintf("%s - %s", v.Description, v.BoxType.Name)
+			}
+			cluster = append(cluster, DuplicateVariant{
+				ID:			v.ID,
+				Title:		v.Game.Title,
+				Slug:		fmt.Sprintf("%s/%d", v.Game.Slug, v.ID),
+				Variant:	desc,
+				Distance:	dist,
+			})
+		}
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(a, b int) bool { return clusters[a][0].ID < clusters[b][0].ID })
+
+	c.JSON(http.StatusOK, gin.H{"distance": threshold, "clusters": clusters})
+}
+
+// HashScans fills in the hashes for variants imported before there were any, from the archived
+// faces or failing that the served front.webp
+func HashScans() error {
+	var variants []models.Variant
+	if err := db.GetDB().Preload("Game").Where("front_hash IS NULL").Find(&variants).Error; err != nil {
+		return err
+	}
+
+	hashed := 0
+	for _, v := range variants {
+		srcDir, err := variantSourceDir(v.Game.Slug, v.ID)
+		if err != nil {
+			return err
+		}
+		scanDir := filepath.Join("uploads/scans", v.Game.Slug, strconv.Itoa(int(v.ID)))
+
+		hash := func(face string, dirs ...string) *uint64 {
+			for _, dir := range dirs {
+				if h, err := tools.HashScan(filepath.Join(dir, face+".webp"), false); err == nil {
+					return &h
+				}
+			}
+			return nil
+		}
+		front, back := hash("front", srcDir, scanDir), hash("back", srcDir)
+		if front == nil {
+			log.Printf("%s (%d) has no front to hash", v.Game.Title, v.ID)
+			continue
+		}
+
+		if err := db.GetDB().Model(&models.Variant{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+			"front_hash":	front,
+			"back_hash":	back,
+		}).Error; err != nil {
+			return err
+		}
+		hashed++
+	}
+
+	log.Printf("Hashed %d of %d variants", hashed, len(variants))
+	return nil
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+// IIIF Presentation 3.0, just the parts a box needs. Spec: https://iiif.io/api/presentation/3.0/
+const (
+	iiifContext		= "http://iiif.io/api/presentation/3/context.json"
+	iiifImage2Profile	= "http://iiif.io/api/image/2/level0.json"
+)
+
+type iiifLang map[string][]string
+
+type iiifMetadata struct {
+	Label	iiifLang	`json:"label"`
+	Value	iiifLang	`json:"value"`
+}
+
+type iiifResource struct {
+	ID		string	`json:"id"`
+	Type	string	`json:"type"`
+	Label	iiifLang	`json:"label,omitempty"`
+	Format	string	`json:"format,omitempty"`
+	Width	int		`json:"width,omitempty"`
+	Height	int		`json:"height,omitempty"`
+	Service	[]iiifService	`json:"service,omitempty"`
+}
+
+// Our tiles are Image API 2, which still uses @id and @type inside a 3.0 manifest
+type iiifService struct {
+	ID		string	`json:"@id"`
+	Type	string	`json:"@type"`
+	Profile	string	`json:"profile"`
+}
+
+type iiifAnnotation struct {
+	ID			string	`json:"id"`
+	Type		string	`json:"type"`
+	Motivation	string	`json:"motivation"`
+	Body		iiifResource	`json:"body"`
+	Target		string	`json:"target"`
+}
+
+type iiifAnnotationPage struct {
+	ID		string	`json:"id"`
+	Type	string	`json:"type"`
+	Items	[]iiifAnnotation	`json:"items"`
+}
+
+type iiifCanvas struct {
+	ID		string	`json:"id"`
+	Type	string	`json:"type"`
+	Label	iiifLang	`json:"label"`
+	Width	int		`json:"width"`
+	Height	int		`json:"height"`
+	Thumbnail	[]iiifResource	`json:"thumbnail,omitempty"`
+	Items	[]iiifAnnotationPage	`json:"items"`
+}
+
+type IIIFManifest struct {
+	Context		string	`json:"@context"`
+	ID			string	`json:"id"`
+	Type		string	`json:"type"`
+	Label		iiifLang	`json:"label"`
+	Summary		iiifLang	`json:"summary,omitempty"`
+	Metadata	[]iiifMetadata	`json:"metadata,omitempty"`
+	RequiredStatement	*iiifMetadata	`json:"requiredStatement,omitempty"`
+	Homepage	[]iiifResource	`json:"homepage,omitempty"`
+	Thumbnail	[]iiifResource	`json:"thumbnail,omitempty"`
+	Items		[]iiifCanvas	`json:"items"`
+}
+
+func iiifEn(s string) iiifLang {
+	return iiifLang{"en": {s}}
+}
+
+// VariantIIIFManifest describes a variant as a IIIF Presentation 3.0 manifest, one canvas per
+// scanned face, so Mirador and friends can show it
+func VariantIIIFManifest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	key := fmt.Sprintf("variant:%d:iiif", id)
+
+	manifest, err := db.GetOrSetCache(key, 10*time.Minute, func() (IIIFManifest, error) {
+		v := getVariants(queryOptions{WhereId: id, Limit: 1, WithDeveloper: true, WithPublisher: true, WithFaces: true})
+		if v == nil {
+			return IIIFManifest{}, fmt.Errorf("404")
+		}
+		return buildIIIFManifest(v[0]), nil
+	})
+	if err != nil {
+		if err.Error() == "404" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Viewers fetch this from wherever they're hosted
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Content-Type", `application/ld+json;profile="`+iiifContext+`"`)
+	c.JSON(http.StatusOK, manifest)
+}
+
+func buildIIIFManifest(v VariantResponse) IIIFManifest {
+	site := strings.TrimSuffix(os.Getenv("SITE_URL"), "/")
+	base := fmt.Sprintf("%s/api/iiif/variants/%d", site, v.ID)
+
+	m := IIIFManifest{
+		Context:	iiifContext,
+		ID:			base + "/manifest.json",
+		Type:		"Manifest",
+		Label:		iiifEn(fmt.Sprintf("%s (%s)", v.GameTitle, v.VariantDesc)),
+		Summary:	iiifEn(v.VariantDesc),
+		Homepage:	[]iiifResource{{ID: site + "/game/" + v.Slug, Type: "Text", Label: iiifEn(v.GameTitle + " | BigBoxDB"), Format: "text/html"}},
+	}
+
+	for _, md := range [][2]string{
+		{"Platform", v.Platform},
+		{"Developer", v.Developer},
+		{"Publisher", v.Publisher},
+		{"Year", strconv.Itoa(v.Year)},
+		{"Region", v.Region},
+		{"Box type", v.BoxTypeName},
+		{"Size", fmt.Sprintf("%g x %g x %g in", v.W, v.H, v.D)},
+		{"Contributed by", v.ContributedBy},
+	} {
+		if md[1] == "" || md[1] == "0" {
+			continue
+		}
+		m.Metadata = append(m.Metadata, iiifMetadata{Label: iiifEn(md[0]), Value: iiifEn(md[1])})
+	}
+	if v.ContributedBy != "" {
+		m.RequiredStatement = &iiifMetadata{Label: iiifEn("Attribution"), Value: iiifEn("BigBoxDB, scanned by " + v.ContributedBy)}
+	}
+
+	faces := v.Faces
+	if len(faces) == 0 {
+		faces = legacyFaces(v)
+	}
+	for _, face := range faces {
+		if len(face.Sizes) == 0 {
+			continue
+		}
+		canvasID := base + "/canvas/" + face.Name
+		biggest, smallest := face.Sizes[len(face.Sizes)-1], face.Sizes[0]
+
+		body := iiifSizeResource(site, biggest)
+		if face.Tiles != "" {
+			body.Service = []iiifService{{ID: site + strings.TrimSuffix(face.Tiles, "/"+tools.FaceTileInfo), Type: "ImageService2", Profile: iiifImage2Profile}}
+		}
+
+		canvas := iiifCanvas{
+			ID:			canvasID,
+			Type:		"Canvas",
+			Label:		iiifEn(faceLabel(face.Name)),
+			Width:		face.Width,
+			Height:		face.Height,
+			Thumbnail:	[]iiifResource{iiifSizeResource(site, smallest)},
+			Items: []iiifAnnotationPage{{
+				ID:		canvasID + "/page",
+				Type:	"AnnotationPage",
+				Items: []iiifAnnotation{{
+					ID:			canvasID + "/page/image",
+					Type:		"Annotation",
+					Motivation:	"painting",
+					Body:		body,
+					Target:		canvasID,
+				}},
+			}},
+		}
+		m.Items = append(m.Items, canvas)
+		if m.Thumbnail == nil {
+			m.Thumbnail = canvas.Thumbnail
+		}
+	}
+	return m
+}
+
+// iiifSizeResource picks WebP if there is one, everything that shows IIIF can do it
+func iiifSizeResource(site string, size tools.FaceSizeImage) iiifResource {
+	format, url := "image/webp", size.URLs["webp"]
+	if url == "" {
+		for f, u := range size.URLs {
+			format, url = "image/"+f, u
+			break
+		}
+	}
+	return iiifResource{ID: site + url, Type: "Image", Format: format, Width: size.Width, Height: size.Height}
+}
+
+// legacyFaces is the one front.webp boxes imported before face images got
+func legacyFaces(v VariantResponse) []tools.FaceImages {
+	path := filepath.Join("uploads/scans", v.GameSlug, strconv.Itoa(int(v.ID)), "front.webp")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil
+	}
+
+	url := fmt.Sprintf("/scans/%s/%d/front.webp", v.GameSlug, v.ID)
+	return []tools.FaceImages{{
+		Name:	"front",
+		Width:	cfg.Width,
+		Height:	cfg.Height,
+		Sizes:	[]tools.FaceSizeImage{{Width: cfg.Width, Height: cfg.Height, URLs: map[string]string{"webp": url}}},
+	}}
+}
+
+// faceLabel turns gatefold_front_left into "Gatefold front left"
+func faceLabel(name string) string {
+	label := strings.ReplaceAll(name, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+const (
+	// Bumped by every import, so a server picks up boxes imported from the CLI too
+	imageIndexVersionKey	= "imagesearch:version"
+	// Without redis there's no telling when something got imported, so just rebuild this often
+	imageIndexMaxAge		= 10 * time.Minute
+
+	photoMaxUpload		= 20 << 20
+	photoMatchLimit		= 10
+	photoMatchMaxLimit	= 50
+)
+
+type imageIndexEntry struct {
+	VariantID	uint
+	ModTime		time.Time
+	Desc		tools.ImageDescriptor
+}
+
+// Every front.webp described once, only the new and changed ones get looked at again on a rebuild
+var imageIndex struct {
+	sync.Mutex
+	entries	[]imageIndexEntry
+	version	int64
+	builtAt	time.Time
+}
+
+type PhotoMatch struct {
+	Score		float64	`json:"score"`	// 0 is the same picture, around 1 is nothing alike
+	Distance	int		`json:"distance"` // Bits the hashes are off by, out of 64
+	Variant		VariantResponse	`json:"variant"`
+}
+
+// VariantsByPhoto takes a photo of a box (multipart "photo") and gives back the variants whose
+// fronts look most like it, ?limit= for more or less of them
+func VariantsByPhoto(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, photoMaxUpload)
+	file, err := c.FormFile("photo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No photo uploaded"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open photo"})
+		return
+	}
+	defer f.Close()
+
+	img, err := tools.OpenPhoto(f)
+	if errors.Is(err, tools.ErrPhotoTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Photo is too big, it can be up to %d megapixels", tools.PhotoMaxPixels/1_000_000)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read photo, it needs to be a JPEG, PNG or WebP"})
+		return
+	}
+
+	limit := photoMatchLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = min(l, photoMatchMaxLimit)
+	}
+
+	guesses := tools.DescribePhoto(img)
+	entries := currentImageIndex()
+
+	matches := make([]PhotoMatch, 0, len(entries))
+	for _, e := range entries {
+		score, bits := tools.MatchPhoto(guesses, e.Desc)
+		matches = append(matches, PhotoMatch{Score: math.Round(score*1000) / 1000, Distance: bits, Variant: VariantResponse{ID: e.VariantID}})
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Score < matches[b].Score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	if len(matches) == 0 {
+		c.JSON(http.StatusOK, matches)
+		return
+	}
+
+	ids := make([]uint, len(matches))
+	for i, m := range matches {
+		ids[i] = m.Variant.ID
+	}
+	variants := make(map[uint]VariantResponse)
+	for _, v := range getVariants(queryOptions{WhereIds: ids, WithDeveloper: true, WithPublisher: true}) {
+		variants[v.ID] = v
+	}
+
+	// Anything deleted since the index was built just drops out
+	results := make([]PhotoMatch, 0, len(matches))
+	for _, m := range matches {
+		if v, ok := variants[m.Variant.ID]; ok {
+			m.Variant = v
+			results = append(results, m)
+		}
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// currentImageIndex rebuilds the index first if something was imported since it was last built
+func currentImageIndex() []imageIndexEntry {
+	imageIndex.Lock()
+	defer imageIndex.Unlock()
+
+	version, err := db.Rdb.Get(db.Ctx, imageIndexVersionKey).Int64()
+	if err == redis.Nil {
+		version, err = 0, nil
+	}
+
+	stale := imageIndex.builtAt.IsZero()
+	if err == nil {
+		stale = stale || version != imageIndex.version
+	} else {
+		stale = stale || time.Since(imageIndex.builtAt) > imageIndexMaxAge
+	}
+
+	if stale {
+		if err := rebuildImageIndex(); err != nil {
+			log.Println("Could not rebuild image search index:", err)
+		} else {
+			imageIndex.version = version
+			imageIndex.builtAt = time.Now()
+		}
+	}
+	return imageIndex.entries
+}
+
+// rebuildImageIndex describes every front.webp, reusing what it already has for ones that haven't changed
+func rebuildImageIndex() error {
+	var rows []struct {
+		ID		uint
+		Slug	string
+	}
+	if err := db.GetDB().Model(&models.Variant{}).
+		Select("variants.id, games.slug").
+		Joins("JOIN games ON games.id = variants.game_id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	known := make(map[uint]imageIndexEntry, len(imageIndex.entries))
+	for _, e := range imageIndex.entries {
+		known[e.VariantID] = e
+	}
+
+	entries := make([]imageIndexEntry, 0, len(rows))
+	described := 0
+	for _, row := range rows {
+		path := filepath.Join("uploads/scans", row.Slug, strconv.Itoa(int(row.ID)), "front.webp")
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if e, ok := known[row.ID]; ok && e.ModTime.Equal(info.ModTime()) {
+			entries = append(entries, e)
+			continue
+		}
+
+		desc, err := tools.DescribeFile(path)
+		if err != nil {
+			log.Printf("Could not describe %s: %v", path, err)
+			continue
+		}
+		entries = append(entries, imageIndexEntry{VariantID: row.ID, ModTime: info.ModTime(), Desc: desc})
+		described++
+	}
+
+	imageIndex.entries = entries
+	if os.Getenv("APP_ENV") != "production" || described > 0 {
+		log.Printf("Image search index has %d fronts (%d new or changed)", len(entries), described)
+	}
+	return nil
+}
+
+// InvalidateImageIndex gets every server to rebuild its image search index on the next search
+func InvalidateImageIndex() {
+	db.Rdb.Incr(db.Ctx, imageIndexVersionKey)
+
+	imageIndex.Lock()
+	imageIndex.builtAt = time.Time{}
+	imageIndex.Unlock()
+}
+
+// WarmImageIndex builds the index ahead of the first search, which would otherwise sit through it
+func WarmImageIndex() {
+	currentImageIndex()
+}
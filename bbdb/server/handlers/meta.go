@@ -5,9 +5,12 @@ import (
     "time"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/adamzwakk/bigboxdb/server/db"
 	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
 )
 
 type Meta struct {
@@ -53,13 +56,21 @@ func GetMeta(slug string, variantID int) (Meta, bool) {
     m := Meta{
         Title:       title,
         Description: fmt.Sprintf("%s (%s)", v.Description, v.BoxType.Name),
-        Image:       fmt.Sprintf("%s/scans/%s/%d/%s", os.Getenv("SITE_URL"), v.Game.Slug, v.ID, "front.webp"),
+        Image:       fmt.Sprintf("%s/scans/%s/%d/%s", os.Getenv("SITE_URL"), v.Game.Slug, v.ID, previewImage(v.Game.Slug, v.ID)),
     }
     setMeta(slug, m)
 
     return m, true
 }
 
+// previewImage is the rendered 3/4 shot when there is one, older imports only have the flat front
+func previewImage(gameSlug string, variantID uint) string {
+	if _, err := os.Stat(filepath.Join("uploads/scans", gameSlug, strconv.Itoa(int(variantID)), tools.HeroFile)); err == nil {
+		return tools.HeroFile
+	}
+	return "front.webp"
+}
+
 func setMeta(slug string, m Meta) {
     data, _ := json.Marshal(m)
     db.Rdb.Set(db.Ctx, "meta:"+slug, data, 15*time.Minute)
@@ -40,13 +40,14 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		database := db.GetDB()
 		var user models.User
-		result := database.Select("id").Where("api_key = ?", parts[1]).First(&user)
+		result := database.Select("id", "name").Where("api_key = ?", parts[1]).First(&user)
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid API key",
 			})
 			return
 		}
+		c.Set("user", user)
 
         c.Next()
     }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+// paletteHexes splits a stored palette back up, nil for variants that don't have one yet
+func paletteHexes(palette *string) []string {
+	if palette == nil || *palette == "" {
+		return nil
+	}
+	return strings.Split(*palette, ",")
+}
+
+// savePalette pulls the dominant colors out of a variant's front.webp and stores them
+func savePalette(variantID uint, gameDir string) error {
+	colors, err := tools.PaletteFile(filepath.Join(gameDir, "front.webp"))
+	if err != nil {
+		return err
+	}
+	if len(colors) == 0 {
+		return fmt.Errorf("no colors found")
+	}
+
+	var hexes []string
+	for _, c := range colors {
+		hexes = append(hexes, c.Hex)
+	}
+
+	if err := db.GetDB().Model(&models.Variant{}).Where("id = ?", variantID).Update("palette", strings.Join(hexes, ",")).Error; err != nil {
+		return err
+	}
+	db.Invalidate(fmt.Sprintf("variant:%d", variantID))
+	return nil
+}
+
+// ExtractPalettes fills in the palette for variants imported before there were any, or every
+// variant with all, and updates their search documents
+func ExtractPalettes(all bool) error {
+	q := db.GetDB().Preload("Game")
+	if !all {
+		q = q.Where("palette IS NULL")
+	}
+	var variants []models.Variant
+	if err := q.Find(&variants).Error; err != nil {
+		return err
+	}
+
+	done := 0
+	for _, v := range variants {
+		gameDir := filepath.Join("uploads/scans", v.Game.Slug, strconv.Itoa(int(v.ID)))
+		if err := savePalette(v.ID, gameDir); err != nil {
+			log.Printf("%s (%d): %v", v.Game.Title, v.ID, err)
+			continue
+		}
+		if err := indexVariant(v.ID); err != nil {
+			log.Printf("Could not reindex %s (%d): %v", v.Game.Title, v.ID, err)
+		}
+		done++
+	}
+
+	log.Printf("Extracted palettes for %d of %d variants", done, len(variants))
+	return nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+)
+
+// Per minute per IP
+const (
+	defaultSearchRateLimit = 60
+	defaultPhotoRateLimit  = 10
+)
+
+// RateLimit lets each client IP make limit requests per window, counted in redis so every server
+// shares the count. If redis is down nobody gets limited.
+func RateLimit(name string, limit int, window time.Duration) gin.HandlerFunc {
+	seconds := int64(window.Seconds())
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			return
+		}
+
+		now := time.Now().Unix()
+		key := fmt.Sprintf("ratelimit:%s:%s:%d", name, c.ClientIP(), now/seconds)
+		count, err := db.Rdb.Incr(db.Ctx, key).Result()
+		if err != nil {
+			return
+		}
+		if count == 1 {
+			db.Rdb.Expire(db.Ctx, key, window)
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(max(0, limit-int(count))))
+		if count > int64(limit) {
+			c.Header("Retry-After", strconv.FormatInt(seconds-now%seconds, 10))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, slow down a bit"})
+			return
+		}
+	}
+}
+
+// SearchRateLimit is RateLimit for /api/search, BBDB_SEARCH_RATE_LIMIT requests a minute (0 for no limit)
+func SearchRateLimit() gin.HandlerFunc {
+	return RateLimit("search", envRateLimit("BBDB_SEARCH_RATE_LIMIT", defaultSearchRateLimit), time.Minute)
+}
+
+// PhotoRateLimit is RateLimit for searching by photo, which is a lot more work per request.
+// BBDB_PHOTO_RATE_LIMIT requests a minute (0 for no limit).
+func PhotoRateLimit() gin.HandlerFunc {
+	return RateLimit("photo", envRateLimit("BBDB_PHOTO_RATE_LIMIT", defaultPhotoRateLimit), time.Minute)
+}
+
+func envRateLimit(name string, fallback int) int {
+	if l, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return l
+	}
+	return fallback
+}
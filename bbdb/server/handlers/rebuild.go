@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+// Normalized faces get kept here on import so the glbs can be made again later.
+// Outside of uploads/scans so they never get served.
+var sourcesDir = "uploads/sources"
+
+var errNoSources = errors.New("no archived source faces")
+
+// RebuildOptions picks which variants RebuildAssets regenerates, only one of them is used
+type RebuildOptions struct {
+	VariantID uint
+	BoxTypeID uint
+	All       bool
+	Workers   int // Defaults to the number of CPUs
+}
+
+func variantSourceDir(slugTitle string, variantID uint) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(wd, sourcesDir, slugTitle, strconv.Itoa(int(variantID))), nil
+}
+
+// archiveSources keeps the processed faces from an import, replacing whatever was archived before
+func archiveSources(texPaths []string, slugTitle string, variantID uint) error {
+	dir, err := variantSourceDir(slugTitle, variantID)
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	for _, p := range texPaths {
+		if !strings.HasSuffix(p, ".webp") {
+			continue
+		}
+		if _, err := tools.Copy(p, filepath.Join(dir, filepath.Base(p))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildAssets regenerates the glbs, previews and exports from the archived faces with
+// the current settings. Variants imported with their own glb (or before faces were archived) get skipped.
+func RebuildAssets(opts RebuildOptions) error {
+	q := db.GetDB().Preload("Game").Preload("BoxType").Order("id")
+	switch {
+	case opts.VariantID > 0:
+		q = q.Where("id = ?", opts.VariantID)
+	case opts.BoxTypeID > 0:
+		q = q.Where("box_type_id = ?", opts.BoxTypeID)
+	case !opts.All:
+		return fmt.Errorf("pick a --variant, --box-type or --all")
+	}
+
+	var variants []models.Variant
+	if err := q.Find(&variants).Error; err != nil {
+		return err
+	}
+	if len(variants) == 0 {
+		return fmt.Errorf("no variants matched")
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan *models.Variant)
+	var done, skipped, failed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range jobs {
+				start := time.Now()
+				err := rebuildVariant(v)
+
+				status := fmt.Sprintf("rebuilt in %s", time.Since(start).Round(time.Millisecond))
+				switch {
+				case errors.Is(err, errNoSources):
+					skipped.Add(1)
+					status = "skipped, " + err.Error()
+				case err != nil:
+					failed.Add(1)
+					status = "FAILED: " + err.Error()
+				}
+				log.Printf("[%d/%d] %s (%d) %s", done.Add(1), len(variants), v.Game.Title, v.ID, status)
+			}
+		}()
+	}
+
+	for i := range variants {
+		jobs <- &variants[i]
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("Rebuilt %d, skipped %d, failed %d", int32(len(variants))-skipped.Load()-failed.Load(), skipped.Load(), failed.Load())
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d variants failed to rebuild", failed.Load())
+	}
+	return nil
+}
+
+// rebuildVariant makes both glbs off to the side and only swaps them in once both came out valid
+func rebuildVariant(v *models.Variant) error {
+	srcDir, err := variantSourceDir(v.Game.Slug, v.ID)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(srcDir)
+	if err != nil || len(entries) == 0 {
+		return errNoSources
+	}
+
+	var texPaths []string
+	for _, e := range entries {
+		texPaths = append(texPaths, filepath.Join(srcDir, e.Name()))
+	}
+
+	tmpDir, err := os.MkdirTemp("/tmp", "rebuild-"+v.Game.Slug+"-"+strconv.Itoa(int(v.ID)))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	gameInfo := &tools.GameInfo{
+		Title:               v.Game.Title,
+		Width:               v.Width,
+		Height:              v.Height,
+		Depth:               v.Depth,
+		BoxType:             v.BoxTypeID,
+		BoxTypeDef:          &v.BoxType,
+		GatefoldTransparent: v.GatefoldTransparent,
+	}
+
+	glbs := []string{"box.glb", "box-low.glb"}
+	for i, name := range glbs {
+		if err := tools.GenerateGLTFBox(gameInfo, texPaths, tmpDir, i == 1); err != nil {
+			return err
+		}
+		problems, err := tools.ValidateGLB(filepath.Join(tmpDir, name))
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%s didn't validate: %s", name, strings.Join(problems, "; "))
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gameDir := filepath.Join(wd, "uploads/scans", v.Game.Slug, strconv.Itoa(int(v.ID)))
+
+	// Previews and exports come along if they were made, the old ones stay otherwise
+	files := glbs
+	for _, name := range tools.DerivedFiles {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err == nil {
+			files = append(files, name)
+		}
+	}
+
+	return swapInFiles(tmpDir, gameDir, files)
+}
+
+// swapInFiles moves files from tmpDir over the ones in gameDir, all of them or none
+func swapInFiles(tmpDir, gameDir string, files []string) error {
+	// Whatever's left staged or backed up goes, however it went
+	defer func() {
+		for _, name := range files {
+			os.Remove(filepath.Join(gameDir, "."+name+".new"))
+			os.Remove(filepath.Join(gameDir, "."+name+".old"))
+		}
+	}()
+
+	// Copy next to the old ones first so the rename is on the same filesystem, and atomic
+	for _, name := range files {
+		staged := filepath.Join(gameDir, "."+name+".new")
+		if _, err := tools.Copy(filepath.Join(tmpDir, name), staged); err != nil {
+			return err
+		}
+	}
+
+	// The old ones get hard linked aside first, so if a rename fails part way through the ones
+	// already swapped can go back and it's never a new box.glb next to an old box-low.glb
+	var swapped []string
+	rollback := func() {
+		for _, name := range swapped {
+			dst, backup := filepath.Join(gameDir, name), filepath.Join(gameDir, "."+name+".old")
+			if _, err := os.Stat(backup); err == nil {
+				os.Rename(backup, dst)
+			} else {
+				os.Remove(dst)
+			}
+		}
+	}
+	for _, name := range files {
+		dst, backup := filepath.Join(gameDir, name), filepath.Join(gameDir, "."+name+".old")
+		os.Remove(backup)
+		if err := os.Link(dst, backup); err != nil && !os.IsNotExist(err) {
+			rollback()
+			return err
+		}
+		if err := os.Rename(filepath.Join(gameDir, "."+name+".new"), dst); err != nil {
+			rollback()
+			return err
+		}
+		swapped = append(swapped, name)
+	}
+	return nil
+}
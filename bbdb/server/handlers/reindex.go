@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+	"gorm.io/gorm"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+const (
+	ReindexBatchSize	= 500
+	searchVerifyPage	= 1000
+	reindexClockSlack	= time.Minute
+)
+
+// waitTask blocks until meilisearch is done with a task, and turns a failed one into an error
+func waitTask(client meilisearch.ServiceManager, task *meilisearch.TaskInfo) error {
+	t, err := client.WaitForTask(task.TaskUID, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	if t.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("%s task %d %s: %s", t.Type, t.UID, t.Status, t.Error.Message)
+	}
+	return nil
+}
+
+// Reindex builds a fresh items index from MySQL off to the side, a batch of variants at a time,
+// and swaps it in once it's all there. Searches keep hitting the old one until then.
+func Reindex(batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = ReindexBatchSize
+	}
+	client := db.InitMeiliSearch()
+	tmp := db.ItemsIndex + "_reindex"
+	// A bit early in case another server's clock is off, pushing a few twice doesn't hurt
+	since := time.Now().Add(-reindexClockSlack)
+
+	// Whatever a reindex that died left behind, the task just fails if there's nothing
+	if task, err := client.DeleteIndex(tmp); err == nil {
+		client.WaitForTask(task.TaskUID, 100*time.Millisecond)
+	}
+	task, err := client.CreateIndex(&meilisearch.IndexConfig{Uid: tmp, PrimaryKey: "variant_id"})
+	if err != nil {
+		return err
+	}
+	if err := waitTask(client, task); err != nil {
+		return err
+	}
+	if err := db.ConfigureIndex(tmp); err != nil {
+		return err
+	}
+
+	pk := "variant_id"
+	var tasks []*meilisearch.TaskInfo
+	var batch []models.Variant
+	total := 0
+	res := searchQuery().Order("variants.id").FindInBatches(&batch, batchSize, func(tx *gorm.DB, n int) error {
+		docs := make([]SearchDocument, 0, len(batch))
+		for _, v := range batch {
+			docs = append(docs, searchDocument(v))
+		}
+		task, err := client.Index(tmp).AddDocuments(docs, &meilisearch.DocumentOptions{PrimaryKey: &pk})
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, task)
+		total += len(docs)
+		log.Printf("Queued %d variants", total)
+		return nil
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	for _, task := range tasks {
+		if err := waitTask(client, task); err != nil {
+			return err
+		}
+	}
+
+	// Swapping needs both sides to exist
+	if _, err := client.GetIndex(db.ItemsIndex); err != nil {
+		task, err := client.CreateIndex(&meilisearch.IndexConfig{Uid: db.ItemsIndex, PrimaryKey: "variant_id"})
+		if err != nil {
+			return err
+		}
+		if err := waitTask(client, task); err != nil {
+			return err
+		}
+	}
+	task, err = client.SwapIndexes([]*meilisearch.SwapIndexesParams{{Indexes: []string{db.ItemsIndex, tmp}}})
+	if err != nil {
+		return err
+	}
+	if err := waitTask(client, task); err != nil {
+		return err
+	}
+
+	// tmp has the old documents now
+	if _, err := client.DeleteIndex(tmp); err != nil {
+		log.Printf("Could not delete the old index: %v", err)
+	}
+
+	// Imports while this ran went to the old index, so push them again now the new one is live
+	var changed []models.Variant
+	if err := searchQuery().
+		Where("variants.created_at >= ? OR variants.updated_at >= ? OR variants.game_id IN (?)",
+			since, since, db.GetDB().Model(&models.Game{}).Select("id").Where("updated_at >= ?", since)).
+		Find(&changed).Error; err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		docs := make([]SearchDocument, 0, len(changed))
+		for _, v := range changed {
+			docs = append(docs, searchDocument(v))
+		}
+		task, err := client.Index(db.ItemsIndex).AddDocuments(docs, &meilisearch.DocumentOptions{PrimaryKey: &pk})
+		if err != nil {
+			return err
+		}
+		if err := waitTask(client, task); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Reindexed %d variants, %d changed along the way", total, len(changed))
+	return nil
+}
+
+// SearchVerify compares every variant in MySQL with its document in the items index and lists the
+// ones missing from search, the ones that don't match what they'd be pushed as now, and documents
+// for variants that are gone. With fix the first two get pushed again and the orphans deleted.
+func SearchVerify(fix bool) error {
+	client := db.InitMeiliSearch()
+	index := client.Index(db.ItemsIndex)
+
+	wanted := make(map[string]SearchDocument)
+	var batch []models.Variant
+	res := searchQuery().Order("variants.id").FindInBatches(&batch, ReindexBatchSize, func(tx *gorm.DB, n int) error {
+		for _, v := range batch {
+			wanted[strconv.Itoa(int(v.ID))] = searchDocument(v)
+		}
+		return nil
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	have := make(map[string]map[string]interface{})
+	for offset := int64(0); ; offset += searchVerifyPage {
+		var page meilisearch.DocumentsResult
+		if err := index.GetDocuments(&meilisearch.DocumentsQuery{Offset: offset, Limit: searchVerifyPage}, &page); err != nil {
+			return fmt.Errorf("could not read the %s index (reindex makes it): %w", db.ItemsIndex, err)
+		}
+		for _, hit := range page.Results {
+			var doc map[string]interface{}
+			if err := hit.Decode(&doc); err != nil {
+				return err
+			}
+			id, _ := doc["variant_id"].(float64)
+			have[strconv.FormatFloat(id, 'f', -1, 64)] = doc
+		}
+		if offset+searchVerifyPage >= page.Total {
+			break
+		}
+	}
+
+	var missing, stale, orphans []string
+	var push []SearchDocument
+	for id, doc := range wanted {
+		got, ok := have[id]
+		if !ok {
+			missing = append(missing, id)
+			push = append(push, doc)
+			continue
+		}
+		// Through JSON so it's compared the same way it'd be stored, extra or old fields included
+		var want map[string]interface{}
+		data, _ := json.Marshal(doc)
+		json.Unmarshal(data, &want)
+		if !reflect.DeepEqual(want, got) {
+			stale = append(stale, id)
+			push = append(push, doc)
+		}
+	}
+	for id := range have {
+		if _, ok := wanted[id]; !ok {
+			orphans = append(orphans, id)
+		}
+	}
+
+	fmt.Printf("%d variants, %d documents\n", len(wanted), len(have))
+	for _, group := range []struct {
+		name	string
+		ids		[]string
+	}{{"Missing", missing}, {"Stale", stale}, {"Orphaned", orphans}} {
+		sortIDs(group.ids)
+		fmt.Printf("%s: %d %v\n", group.name, len(group.ids), group.ids)
+	}
+
+	if !fix || len(push)+len(orphans) == 0 {
+		return nil
+	}
+
+	if len(push) > 0 {
+		pk := "variant_id"
+		task, err := index.AddDocuments(push, &meilisearch.DocumentOptions{PrimaryKey: &pk})
+		if err != nil {
+			return err
+		}
+		if err := waitTask(client, task); err != nil {
+			return err
+		}
+	}
+	if len(orphans) > 0 {
+		task, err := index.DeleteDocuments(orphans, nil)
+		if err != nil {
+			return err
+		}
+		if err := waitTask(client, task); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Pushed %d, deleted %d\n", len(push), len(orphans))
+	return nil
+}
+
+// sortIDs puts numeric ids in number order, so 10 comes after 9
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(a, b int) bool {
+		x, _ := strconv.Atoi(ids[a])
+		y, _ := strconv.Atoi(ids[b])
+		return x < y
+	})
+}
@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meilisearch/meilisearch-go"
+	"gorm.io/gorm"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
+)
+
+// SearchDocument is a variant the way the items index has it, see db.ConfigureItemsIndex for
+// what gets searched, filtered and sorted on
+type SearchDocument struct {
+	VariantID		uint		`json:"variant_id"`
+	GameID			uint		`json:"game_id"`
+	Slug			string		`json:"slug"` // The game's, the front end builds urls from it and variant_id
+	Title			string		`json:"title"`
+	Variant			string		`json:"variant"`
+	Description		string		`json:"description"`
+	Year			int			`json:"year"`
+	Region			string		`json:"region"`
+	Platform		string		`json:"platform"`
+	BoxType			string		`json:"box_type"`
+	Developer		string		`json:"developer"`
+	Publisher		string		`json:"publisher"`
+	ContributedBy	string		`json:"contributed_by"`
+	ContributorID	uint		`json:"contributor_id"` // What contributor search tokens are filtered on
+	Palette			[]string	`json:"palette"`
+	Colors			[]string	`json:"colors"`
+	CreatedAt		int64		`json:"created_at"` // Unix time so it sorts
+}
+
+// searchQuery loads variants with everything a SearchDocument needs
+func searchQuery() *gorm.DB {
+	return db.GetDB().
+		Preload("Game").
+		Preload("Game.Platform").
+		Preload("BoxType").
+		Preload("Region").
+		Preload("Developer").
+		Preload("Publisher").
+		Preload("User")
+}
+
+func searchDocument(v models.Variant) SearchDocument {
+	variant := v.BoxType.Name
+	if v.Description != "" {
+		variant = fmt.Sprintf("%s - %s", v.Description, v.BoxType.Name)
+	}
+	palette := paletteHexes(v.Palette)
+	description := ""
+	if v.Game.Description != nil {
+		description = *v.Game.Description
+	}
+
+	return SearchDocument{
+		VariantID:		v.ID,
+		GameID:			v.GameID,
+		Slug:			v.Game.Slug,
+		Title:			v.Game.Title,
+		Variant:		variant,
+		Description:	description,
+		Year:			v.Year,
+		Region:			v.Region.Name,
+		Platform:		v.Game.Platform.Name,
+		BoxType:		v.BoxType.Name,
+		Developer:		v.Developer.Name,
+		Publisher:		v.Publisher.Name,
+		ContributedBy:	v.User.Name,
+		ContributorID:	v.UserID,
+		Palette:		palette,
+		Colors:			tools.PaletteFamilies(palette),
+		CreatedAt:		v.CreatedAt.Unix(),
+	}
+}
+
+// indexVariant pushes a variant's whole document to the items index, replacing what was there
+func indexVariant(variantID uint) error {
+	var v models.Variant
+	if err := searchQuery().First(&v, variantID).Error; err != nil {
+		return err
+	}
+
+	pk := "variant_id"
+	_, err := db.InitMeiliSearch().Index(db.ItemsIndex).AddDocuments([]SearchDocument{searchDocument(v)}, &meilisearch.DocumentOptions{
+		PrimaryKey: &pk,
+	})
+	return err
+}
+
+const (
+	searchPerPage		= 20
+	searchMaxPerPage	= 100
+)
+
+// Filters that take names, ?platform=DOS&platform=Windows is either of them. The columns are for
+// when it has to fall back to MySQL, colors only live in search.
+var searchFilterColumns = map[string]string{
+	"platform":			"platforms.name",
+	"box_type":			"box_types.name",
+	"region":			"regions.name",
+	"developer":		"developers.name",
+	"publisher":		"publishers.name",
+	"contributed_by":	"users.name",
+	"colors":			"",
+}
+
+var searchSortColumns = map[string]string{
+	"title":		"games.title",
+	"year":			"variants.year",
+	"created_at":	"variants.created_at",
+}
+
+var searchFacetColumns = map[string]string{
+	"platform":		"platforms.name",
+	"box_type":		"box_types.name",
+	"region":		"regions.name",
+	"year":			"variants.year",
+	"developer":	"developers.name",
+	"publisher":	"publishers.name",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+type searchParams struct {
+	Query		string
+	Filters		map[string][]string
+	YearFrom	int
+	YearTo		int
+	SortField	string
+	SortDir		string
+	Facets		[]string
+	Page		int
+	PerPage		int
+}
+
+type SearchResults struct {
+	Query		string		`json:"query"`
+	Hits		[]VariantResponse	`json:"hits"`
+	Total		int64		`json:"total"`
+	Page		int			`json:"page"`
+	PerPage		int			`json:"per_page"`
+	TotalPages	int64		`json:"total_pages"`
+	Facets		map[string]map[string]int64	`json:"facets,omitempty"`
+	Source		string		`json:"source"` // meilisearch, or database when that's down
+}
+
+// Search looks through the boxes, see the README for the parameters. Meilisearch does the work,
+// MySQL LIKE stands in when it can't.
+func Search(c *gin.Context) {
+	p := parseSearchParams(c)
+
+	results, err := searchMeili(p)
+	if err != nil {
+		log.Println("Search falling back to the database:", err)
+		results, err = searchDatabase(p)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func parseSearchParams(c *gin.Context) searchParams {
+	p := searchParams{
+		Query:		strings.TrimSpace(c.Query("q")),
+		Filters:	make(map[string][]string),
+		Page:		1,
+		PerPage:	searchPerPage,
+	}
+
+	for field := range searchFilterColumns {
+		for _, v := range c.QueryArray(field) {
+			if v = strings.TrimSpace(v); v != "" {
+				p.Filters[field] = append(p.Filters[field], v)
+			}
+		}
+	}
+	if y, err := strconv.Atoi(c.Query("year")); err == nil {
+		p.YearFrom, p.YearTo = y, y
+	}
+	if y, err := strconv.Atoi(c.Query("year_from")); err == nil {
+		p.YearFrom = y
+	}
+	if y, err := strconv.Atoi(c.Query("year_to")); err == nil {
+		p.YearTo = y
+	}
+
+	if field, dir, _ := strings.Cut(c.Query("sort"), ":"); searchSortColumns[field] != "" {
+		p.SortField, p.SortDir = field, "asc"
+		if dir == "desc" {
+			p.SortDir = "desc"
+		}
+	}
+
+	for _, f := range strings.Split(c.Query("facets"), ",") {
+		if f = strings.TrimSpace(f); slices.Contains(db.ItemsFacets, f) {
+			p.Facets = append(p.Facets, f)
+		}
+	}
+
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		p.Page = page
+	}
+	if per, err := strconv.Atoi(c.Query("per_page")); err == nil && per > 0 {
+		p.PerPage = min(per, searchMaxPerPage)
+	}
+	return p
+}
+
+// meiliQuote makes a value safe to put in a filter string
+func meiliQuote(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+func searchMeili(p searchParams) (SearchResults, error) {
+	// Every field has to match, any value within one does
+	var filter []interface{}
+	for field, values := range p.Filters {
+		var anyOf []string
+		for _, v := range values {
+			anyOf = append(anyOf, fmt.Sprintf("%s = %s", field, meiliQuote(v)))
+		}
+		filter = append(filter, anyOf)
+	}
+	if p.YearFrom != 0 {
+		filter = append(filter, fmt.Sprintf("year >= %d", p.YearFrom))
+	}
+	if p.YearTo != 0 {
+		filter = append(filter, fmt.Sprintf("year <= %d", p.YearTo))
+	}
+
+	req := &meilisearch.SearchRequest{
+		AttributesToRetrieve:	[]string{"variant_id"},
+		Facets:					p.Facets,
+		Page:					int64(p.Page),
+		HitsPerPage:			int64(p.PerPage),
+	}
+	if len(filter) > 0 {
+		req.Filter = filter
+	}
+	if p.SortField != "" {
+		req.Sort = []string{p.SortField + ":" + p.SortDir}
+	}
+
+	resp, err := db.InitMeiliSearch().Index(db.ItemsIndex).Search(p.Query, req)
+	if err != nil {
+		return SearchResults{}, err
+	}
+
+	var ids []uint
+	for _, hit := range resp.Hits {
+		var doc struct {
+			VariantID uint `json:"variant_id"`
+		}
+		if err := hit.Decode(&doc); err == nil {
+			ids = append(ids, doc.VariantID)
+		}
+	}
+
+	results := SearchResults{
+		Query:		p.Query,
+		Hits:		variantsInOrder(ids),
+		Total:		resp.TotalHits,
+		Page:		p.Page,
+		PerPage:	p.PerPage,
+		TotalPages:	resp.TotalPages,
+		Source:		"meilisearch",
+	}
+	if len(resp.FacetDistribution) > 0 {
+		json.Unmarshal(resp.FacetDistribution, &results.Facets)
+	}
+	return results, nil
+}
+
+// searchDatabase is the same search done with LIKE, for when meilisearch is down. No typo
+// tolerance, synonyms or color filtering, and the order is just by title.
+func searchDatabase(p searchParams) (SearchResults, error) {
+	q := db.GetDB().Model(&models.Variant{}).
+		Joins("JOIN games ON games.id = variants.game_id").
+		Joins("LEFT JOIN platforms ON platforms.id = games.platform_id").
+		Joins("LEFT JOIN box_types ON box_types.id = variants.box_type_id").
+		Joins("LEFT JOIN regions ON regions.id = variants.region_id").
+		Joins("LEFT JOIN developers ON developers.id = variants.developer_id").
+		Joins("LEFT JOIN publishers ON publishers.id = variants.publisher_id").
+		Joins("LEFT JOIN users ON users.id = variants.user_id")
+
+	if p.Query != "" {
+		like := "%" + likeEscaper.Replace(p.Query) + "%"
+		q = q.Where("(games.title LIKE ? OR variants.description LIKE ? OR developers.name LIKE ? OR publishers.name LIKE ? OR platforms.name LIKE ?)", like, like, like, like, like)
+	}
+	for field, values := range p.Filters {
+		if col := searchFilterColumns[field]; col != "" {
+			q = q.Where(col+" IN ?", values)
+		}
+	}
+	if p.YearFrom != 0 {
+		q = q.Where("variants.year >= ?", p.YearFrom)
+	}
+	if p.YearTo != 0 {
+		q = q.Where("variants.year <= ?", p.YearTo)
+	}
+	q = q.Session(&gorm.Session{})
+
+	results := SearchResults{Query: p.Query, Page: p.Page, PerPage: p.PerPage, Source: "database"}
+	if err := q.Count(&results.Total).Error; err != nil {
+		return results, err
+	}
+	results.TotalPages = (results.Total + int64(p.PerPage) - 1) / int64(p.PerPage)
+
+	for _, f := range p.Facets {
+		col := searchFacetColumns[f]
+		if col == "" {
+			continue
+		}
+		var rows []struct {
+			Value	string
+			Count	int64
+		}
+		if err := q.Select("COALESCE(" + col + ", '') AS value, COUNT(*) AS count").Group(col).Scan(&rows).Error; err != nil {
+			return results, err
+		}
+		if results.Facets == nil {
+			results.Facets = make(map[string]map[string]int64)
+		}
+		results.Facets[f] = make(map[string]int64)
+		for _, r := range rows {
+			results.Facets[f][r.Value] = r.Count
+		}
+	}
+
+	order := "games.title asc"
+	if p.SortField != "" {
+		order = searchSortColumns[p.SortField] + " " + p.SortDir
+	}
+	var ids []uint
+	if err := q.Order(order).Order("variants.id").
+		Limit(p.PerPage).Offset((p.Page-1)*p.PerPage).
+		Pluck("variants.id", &ids).Error; err != nil {
+		return results, err
+	}
+	results.Hits = variantsInOrder(ids)
+	return results, nil
+}
+
+// variantsInOrder loads variants by id and keeps them in the order asked for
+func variantsInOrder(ids []uint) []VariantResponse {
+	hits := []VariantResponse{}
+	if len(ids) == 0 {
+		return hits
+	}
+	byID := make(map[uint]VariantResponse)
+	for _, v := range getVariants(queryOptions{WhereIds: ids, WithDeveloper: true, WithPublisher: true}) {
+		byID[v.ID] = v
+	}
+	for _, id := range ids {
+		if v, ok := byID[id]; ok {
+			hits = append(hits, v)
+		}
+	}
+	return hits
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meilisearch/meilisearch-go"
+
+	"github.com/adamzwakk/bigboxdb/server/db"
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+const defaultSearchTokenTTL = time.Hour
+
+type SearchTokenResponse struct {
+	Token		string		`json:"token"`
+	Index		string		`json:"index"`
+	ExpiresAt	time.Time	`json:"expires_at"`
+}
+
+// searchTokenTTL reads BBDB_SEARCH_TOKEN_TTL ("30m", "2h"), falling back to an hour
+func searchTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("BBDB_SEARCH_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultSearchTokenTTL
+}
+
+// SearchToken hands out a short lived Meilisearch tenant token that can only search the items
+// index. Behind AuthMiddleware the contributor gets one that only sees their own boxes.
+func SearchToken(c *gin.Context) {
+	key, err := db.SearchKey()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Search is unavailable"})
+		return
+	}
+
+	rules := map[string]interface{}{db.ItemsIndex: map[string]interface{}{}}
+	if u, ok := c.Get("user"); ok {
+		user := u.(models.User)
+		rules[db.ItemsIndex] = map[string]interface{}{"filter": fmt.Sprintf("contributor_id = %d", user.ID)}
+	}
+
+	expires := time.Now().Add(searchTokenTTL()).UTC().Truncate(time.Second)
+	token, err := db.InitMeiliSearch().GenerateTenantToken(key.UID, rules, &meilisearch.TenantTokenOptions{
+		APIKey:		key.Key,
+		ExpiresAt:	expires,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, SearchTokenResponse{Token: token, Index: db.ItemsIndex, ExpiresAt: expires})
+}
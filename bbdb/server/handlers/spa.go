@@ -30,7 +30,7 @@ func SiteMap() *sitemap.Sitemap {
                 Priority: 1,
                 ChangeFreq: sitemap.Weekly,
                 Title:    v.GameTitle+" | BigBoxDB",
-                Images:   []sitemap.Image{{URL: "https://www.bigboxdb.com/scans/"+v.Slug+"/front.webp", Title: v.GameTitle+" | BigBoxDB"}},
+                Images:   []sitemap.Image{{URL: fmt.Sprintf("https://www.bigboxdb.com/scans/%s/%d/%s", v.GameSlug, v.ID, previewImage(v.GameSlug, v.ID)), Title: v.GameTitle+" | BigBoxDB"}},
             })
         }
     }
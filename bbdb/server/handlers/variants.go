@@ -3,14 +3,18 @@ package handlers
 import (
 	"net/http"
 	"fmt"
+	"os"
 	"time"
 	"strconv"
+	"path/filepath"
+	"encoding/json"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"github.com/adamzwakk/bigboxdb/server/db"
 	"github.com/adamzwakk/bigboxdb/server/models"
+	"github.com/adamzwakk/bigboxdb/tools"
 )
 
 type VariantResponse struct {
@@ -37,18 +41,35 @@ type VariantResponse struct {
 	TexturePath	string	`json:"textureFileName"`
 	ContributedBy	string	`json:"contributed_by"`
 	AddedOn		time.Time	`json:"created_at"`
+	Items		[]VariantItemResponse	`json:"items,omitempty"`
+	Faces		[]tools.FaceImages	`json:"faces,omitempty"` // Every size of every scanned face, for srcset and zooming
+	Palette		[]string	`json:"palette,omitempty"` // Dominant colors of the front, biggest first
+}
+
+type VariantItemResponse struct {
+	ID			uint	`json:"id"`
+	Kind		string	`json:"kind"`
+	Name		string	`json:"name"`
+	W			float32	`json:"w"`
+	H			float32	`json:"h"`
+	D			float32	`json:"d"`
+	Pages		int		`json:"pages,omitempty"`
+	ModelPath	string	`json:"modelFileName"`
 }
 
 type queryOptions struct {
 	Select			string
 	Order			string
 	WhereId			int
+	WhereIds		[]uint
 	WhereSlug		string
 	Limit			int		`default:"0"`
 	Offset			int		`default:"0"`
 	GroupBy			string
 	WithDeveloper	bool
 	WithPublisher	bool
+	WithItems		bool
+	WithFaces		bool
 }
 
 type BoxTypeCount struct {
@@ -86,10 +107,10 @@ func VariantById(c *gin.Context) {
        c.AbortWithStatus(http.StatusBadRequest)
        return // but you're inside the closure, so you'd need to restructure
    }
-    key := fmt.Sprintf("variant:%s", id)
+    key := fmt.Sprintf("variant:%d", id)
     
     variant, err := db.GetOrSetCache(key, 5*time.Minute, func() (VariantResponse, error) {
-        o := queryOptions{WhereId: id, Limit: 1}
+        o := queryOptions{WhereId: id, Limit: 1, WithItems: true, WithFaces: true}
 		v := getVariants(o)
 
 		if v != nil {
@@ -110,6 +131,73 @@ func VariantById(c *gin.Context) {
 	c.JSON(http.StatusOK, variant)
 }
 
+// VariantManual serves the page manifest for a variant's scanned manual
+func VariantManual(c *gin.Context) {
+    id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	key := fmt.Sprintf("variant:%d:manual", id)
+
+	manifest, err := db.GetOrSetCache(key, 10*time.Minute, func() (tools.ManualManifest, error) {
+		var manifest tools.ManualManifest
+
+		v := getVariants(queryOptions{WhereId: id, Limit: 1})
+		if v == nil {
+			return manifest, fmt.Errorf("404")
+		}
+
+		wd, _ := os.Getwd()
+		data, err := os.ReadFile(filepath.Join(wd, "uploads/scans", v[0].GameSlug, strconv.Itoa(id), tools.ManualDir, "manifest.json"))
+		if err != nil {
+			return manifest, fmt.Errorf("404")
+		}
+		err = json.Unmarshal(data, &manifest)
+		return manifest, err
+	})
+	if err != nil {
+		if err.Error() == "404" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// VariantExport downloads one of the box's other formats, see tools.ExportFiles
+func VariantExport(c *gin.Context) {
+    id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	filename, ok := tools.ExportFiles[c.Param("format")]
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	v := getVariants(queryOptions{WhereId: id, Limit: 1})
+	if v == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	wd, _ := os.Getwd()
+	path := filepath.Join(wd, "uploads/scans", v[0].GameSlug, strconv.Itoa(id), filename)
+	if _, err := os.Stat(path); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.FileAttachment(path, fmt.Sprintf("%s-%d-%s", v[0].GameSlug, id, filename))
+}
+
 func VariantsRandom(c *gin.Context) {
     // Don't cache random - always fetch fresh
     o := queryOptions{Order: "rand()", Limit: 1}
@@ -142,7 +230,7 @@ func getVariants(options queryOptions) []VariantResponse{
 
 	q := d.Joins("Game", d.Select("id", "Title", "Slug", "Year", "PlatformID")).
 	Preload("BoxType", func(db *gorm.DB) *gorm.DB {
-		return db.Select("id", "Name")
+		return db.Select("id", "Name", "ShelfDirection")
 	}).Preload("Region", func(db *gorm.DB) *gorm.DB {
 		return db.Select("id", "Name")
 	}).Preload("Game.Platform", func(db *gorm.DB) *gorm.DB {
@@ -163,10 +251,20 @@ func getVariants(options queryOptions) []VariantResponse{
 		})
 	}
 
+	if options.WithItems {
+		q = q.Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("sort_order asc")
+		})
+	}
+
 	if options.WhereId > 0 {
 		q = q.Where("variants.id = ?", options.WhereId)
 	}
 
+	if len(options.WhereIds) > 0 {
+		q = q.Where("variants.id IN ?", options.WhereIds)
+	}
+
 	if options.Order != "" {
 		q = q.Order(options.Order)
 	}
@@ -191,10 +289,6 @@ func getVariants(options queryOptions) []VariantResponse{
 
 	var resp []VariantResponse
 	for _, v := range variants {
-		dir := 0
-		if v.BoxType.ID == models.FindBoxTypeIDByName("Eidos Trapezoid") {
-			dir = 1
-		}
 		title := v.BoxType.Name
 		if v.Description != "" {
 			title = fmt.Sprintf("%s - %s", v.Description, v.BoxType.Name)
@@ -217,14 +311,37 @@ func getVariants(options queryOptions) []VariantResponse{
 			W:		v.Width,
 			H:		v.Height,
 			D:		v.Depth,
-			Direction: dir,
+			Direction: v.BoxType.ShelfDirection,
 			BoxType:	v.BoxType.ID,
 			BoxTypeName:	v.BoxType.Name,
 			TexturePath: fmt.Sprintf("/scans/%s/%d/%s", v.Game.Slug, v.ID, "box.glb"),
 			ContributedBy: v.User.Name,
 			AddedOn: v.CreatedAt,
+			Items: itemResponses(v),
+			Palette: paletteHexes(v.Palette),
 		})
+
+		if options.WithFaces {
+			resp[len(resp)-1].Faces = tools.ReadFaceManifest(filepath.Join("uploads/scans", v.Game.Slug, strconv.Itoa(int(v.ID)), tools.FacesDir))
+		}
 	}
 
 	return resp
-}
\ No newline at end of file
+}
+
+func itemResponses(v models.Variant) []VariantItemResponse {
+	var items []VariantItemResponse
+	for _, item := range v.Items {
+		items = append(items, VariantItemResponse{
+			ID:		item.ID,
+			Kind:	item.Kind,
+			Name:	item.Name,
+			W:		item.Width,
+			H:		item.Height,
+			D:		item.Depth,
+			Pages:	item.Pages,
+			ModelPath: fmt.Sprintf("/scans/%s/%d/items/%s.glb", v.Game.Slug, v.ID, item.Slug),
+		})
+	}
+	return items
+}
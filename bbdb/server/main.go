@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"net/http"
@@ -13,6 +15,7 @@ import (
 	"github.com/adamzwakk/bigboxdb/server/db"
 	"github.com/adamzwakk/bigboxdb/server/models"
 	"github.com/adamzwakk/bigboxdb/server/handlers"
+	"github.com/adamzwakk/bigboxdb/tools"
 )
 
 func main() {
@@ -21,13 +24,27 @@ func main() {
 	db.InitRedis()
 
 	if slices.Contains(args, "init-meilisearch") {
-		db.InitMeilisearchPublic()
+		if err := db.ConfigureItemsIndex(); err != nil {
+			log.Fatal(err.Error())
+		}
+		key, err := db.SearchKey()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Printf("Search tokens get signed with key %s", key.UID)
+	} else if slices.Contains(args, "rotate-search-keys") {
+		// NEW TOKEN SIGNING KEY, REVOKE THE REST
+		if err := db.RotateSearchKeys(); err != nil {
+			log.Fatal(err.Error())
+		}
 	} else if slices.Contains(args, "migrate") {
 		// SEED/MIGRATE DB
 		database := db.GetDB()
 		if err := database.AutoMigrate(
+			&models.BoxType{},
 			&models.Game{},
 			&models.Variant{},
+			&models.VariantItem{},
 			&models.LinkType{},
 			&models.Link{},
 			&db.SeedMeta{},
@@ -46,9 +63,84 @@ func main() {
 			log.Fatal(err.Error())
 			return
 		}
+	} else if slices.Contains(args, "rebuild-assets") {
+		// REGENERATE GLBS FROM ARCHIVED FACES
+		fs := flag.NewFlagSet("rebuild-assets", flag.ExitOnError)
+		variantID := fs.Uint("variant", 0, "rebuild one variant")
+		boxTypeID := fs.Uint("box-type", 0, "rebuild every variant of a box type")
+		all := fs.Bool("all", false, "rebuild everything")
+		workers := fs.Int("workers", 0, "how many to build at once (default: number of CPUs)")
+		fs.Parse(args[1:])
+
+		if err := handlers.RebuildAssets(handlers.RebuildOptions{
+			VariantID: *variantID,
+			BoxTypeID: *boxTypeID,
+			All:       *all,
+			Workers:   *workers,
+		}); err != nil {
+			log.Fatal(err.Error())
+		}
+	} else if slices.Contains(args, "hash-scans") {
+		// BACKFILL DUPLICATE DETECTION HASHES
+		if err := handlers.HashScans(); err != nil {
+			log.Fatal(err.Error())
+		}
+	} else if slices.Contains(args, "extract-palettes") {
+		// BACKFILL FRONT COLOR PALETTES
+		if err := handlers.ExtractPalettes(slices.Contains(args, "--all")); err != nil {
+			log.Fatal(err.Error())
+		}
+	} else if slices.Contains(args, "reindex") {
+		// REBUILD THE SEARCH INDEX FROM MYSQL
+		fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+		batch := fs.Int("batch", handlers.ReindexBatchSize, "variants per batch")
+		fs.Parse(args[1:])
+
+		if err := handlers.Reindex(*batch); err != nil {
+			log.Fatal(err.Error())
+		}
+	} else if slices.Contains(args, "search-verify") {
+		// DIFF MYSQL AGAINST THE SEARCH INDEX
+		fs := flag.NewFlagSet("search-verify", flag.ExitOnError)
+		fix := fs.Bool("fix", false, "push missing and stale documents, delete orphans")
+		fs.Parse(args[1:])
+
+		if err := handlers.SearchVerify(*fix); err != nil {
+			log.Fatal(err.Error())
+		}
+	} else if slices.Contains(args, "glb") {
+		// INSPECT/VALIDATE A GENERATED GLB
+		if len(args) < 3 {
+			log.Fatal("usage: glb inspect|validate <file>")
+		}
+
+		switch args[1] {
+		case "inspect":
+			if err := tools.InspectGLB(args[2], os.Stdout); err != nil {
+				log.Fatal(err.Error())
+			}
+		case "validate":
+			problems, err := tools.ValidateGLB(args[2])
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+			if len(problems) > 0 {
+				os.Exit(1)
+			}
+			fmt.Println("OK")
+		default:
+			log.Fatal("usage: glb inspect|validate <file>")
+		}
 	} else if slices.Contains(args, "host") {
 		// MAIN WEB SERVER
 		r := gin.Default()
+		// Only nginx in front of us gets to say who the client is, and only through X-Real-IP
+		// which it always overwrites, so nobody dodges the rate limits with their own X-Forwarded-For
+		r.SetTrustedProxies([]string{"127.0.0.1"})
+		r.RemoteIPHeaders = []string{"X-Real-IP"}
 		
 		{
 			r.GET("/sitemap.xml", ginadapter.Sitemap(handlers.SiteMap))
@@ -61,6 +153,9 @@ func main() {
 				})
 			})
 
+			a.GET("/search", handlers.SearchRateLimit(), handlers.Search)
+			a.GET("/search/token", handlers.SearchToken)
+
 			g := a.Group("/games")
 			g.GET("/all", handlers.GamesAll)
 			g.GET("/:slug", handlers.GameBySlug)
@@ -73,15 +168,23 @@ func main() {
 
 			v := a.Group("/variants")
 			v.GET("/:id", handlers.VariantById)
+			v.GET("/:id/manual", handlers.VariantManual)
+			v.GET("/:id/export/:format", handlers.VariantExport)
 			v.GET("/all", handlers.VariantsAll)
 			v.GET("/latest", handlers.VariantsLatest)
 			v.GET("/botd", handlers.VariantsRandom)
 			v.GET("/typecount", handlers.VariantsCountBoxTypes)
+			v.POST("/by-photo", handlers.PhotoRateLimit(), handlers.VariantsByPhoto)
+
+			iiif := a.Group("/iiif")
+			iiif.GET("/variants/:id/manifest.json", handlers.VariantIIIFManifest)
 
 			ad := a.Group("/admin")
 			ad.Use(handlers.AuthMiddleware())
 			{
 				ad.PUT("/import", handlers.AdminImport)
+				ad.GET("/duplicates", handlers.AdminDuplicates)
+				ad.GET("/search/token", handlers.SearchToken)
 			}
 		}
 
@@ -90,6 +193,8 @@ func main() {
 			r.Static("/scans", "./uploads/scans")
 		}
 
+		go handlers.WarmImageIndex()
+
 		r.Run(":8080")
 	}
 }
\ No newline at end of file
@@ -4,41 +4,79 @@ import (
 	"time"
 )
 
+// Box shapes the geometry generator knows how to build
+const (
+	BoxShapeCuboid			= "cuboid"
+	BoxShapeTrapezoid		= "trapezoid"
+	BoxShapeJewelCase		= "jewel_case"
+	BoxShapeKeepCase		= "keep_case"
+)
+
+// Gatefold layouts, see tools.GatefoldMode for what each one generates
+const (
+	GatefoldLayoutNone			= "none"
+	GatefoldLayoutSingleFront	= "single_front"
+	GatefoldLayoutSingleBack	= "single_back"
+	GatefoldLayoutDoubleFront	= "double_front"
+	GatefoldLayoutFrontAndBack	= "front_and_back"
+	GatefoldLayoutTrifold		= "trifold_front"
+	GatefoldLayoutDoublePanel	= "double_panel_front"
+)
+
+// Which edge of the box a gatefold flap swings from
+const (
+	HingeLeft		= "left"
+	HingeRight		= "right"
+	HingeTop		= "top"
+)
+
+// BoxType describes a packaging style. Everything the glb generator needs to know
+// about a shape lives here, so a new style is just a new row in box_types.
 type BoxType struct{
 	ID						uint
 	Name					string	`gorm:"type:varchar(255);not null;"`
 	Width					*float32 `gorm:"default:null"`
 	Height					*float32 `gorm:"default:null"`
 	Depth					*float32 `gorm:"default:null"`
+
+	Shape					string	`gorm:"type:varchar(32);not null;default:'cuboid';"`
+	TopWidthRatio			*float32 `gorm:"default:null"` // Trapezoids only, top edge width as a ratio of the bottom edge
+	GatefoldLayout			string	`gorm:"type:varchar(32);not null;default:'none';"`
+	GatefoldHinge			string	`gorm:"type:varchar(16);not null;default:'left';"` // Hinge of the front flap, back flaps mirror it
+	FaceRotation			int		`gorm:"not null;default:0;"` // For artwork scanned sideways, in degrees
+	ShelfDirection			int		`gorm:"not null;default:0;"` // 0 = spine out, 1 = front out
+
 	CreatedAt 				time.Time
 	UpdatedAt 				time.Time
 }
 
 func f32(v float32) *float32 { return &v }
 
+// Seed data for box_types, the table is the source of truth once migrated
 var BoxtypesEnum = []BoxType{
-	{ID:1, Name: "Big Box"},
-	{ID:2, Name: "Small Box"},
-	{ID:3, Name: "Eidos Trapezoid", Width: f32(10), Height: f32(10), Depth: f32(2)},
-	{ID:4, Name: "DVD Case Slipcover"},
-	{ID:5, Name: "Old Small Box"},
-	{ID:6, Name: "Box in Box"},
-	{ID:7, Name: "Big Box With Gatefold"},
-	{ID:8, Name: "Small Box With Gatefold"},
-	{ID:9, Name: "Small Box With Vertical Gatefold"},
-	{ID:10, Name: "Big Box With Back Gatefold"},
-	{ID:11, Name: "New Small Box"},
-	{ID:12, Name: "New Big Box"},
-	{ID:13, Name: "Small Box For DVD"},
-	{ID:14, Name: "Big Long Box"},
-	{ID:15, Name: "Big Box With Vertical Gatefold But Horizontal"},
-	{ID:16, Name: "Small Box With Gatefold Right Flap"},
-	{ID:17, Name: "DVD Case Slipcover with Gatefold"},
-	{ID:18, Name: "New Box in Box"},
-	{ID:19, Name: "Vinyl Like With Gatefold"},
-	{ID:20, Name: "Vinyl Like With Double Gatefold"},
-	{ID:21, Name: "Big Box With Front And Back Gatefold"},
-	{ID:22, Name: "Jewel Case"},
+	{ID:1, Name: "Big Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:2, Name: "Small Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:3, Name: "Eidos Trapezoid", Width: f32(10), Height: f32(10), Depth: f32(2), Shape: BoxShapeTrapezoid, TopWidthRatio: f32(0.575), GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeTop, ShelfDirection: 1},
+	{ID:4, Name: "DVD Case Slipcover", Width: f32(5.3), Height: f32(7.5), Depth: f32(0.55), Shape: BoxShapeKeepCase, GatefoldLayout: GatefoldLayoutNone},
+	{ID:5, Name: "Old Small Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:6, Name: "Box in Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:7, Name: "Big Box With Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeLeft},
+	{ID:8, Name: "Small Box With Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeLeft},
+	{ID:9, Name: "Small Box With Vertical Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeTop},
+	{ID:10, Name: "Big Box With Back Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleBack, GatefoldHinge: HingeLeft},
+	{ID:11, Name: "New Small Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:12, Name: "New Big Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:13, Name: "Small Box For DVD", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:14, Name: "Big Long Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:15, Name: "Big Box With Vertical Gatefold But Horizontal", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeTop, FaceRotation: 90},
+	{ID:16, Name: "Small Box With Gatefold Right Flap", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeRight},
+	{ID:17, Name: "DVD Case Slipcover with Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeLeft},
+	{ID:18, Name: "New Box in Box", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutNone},
+	{ID:19, Name: "Vinyl Like With Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutSingleFront, GatefoldHinge: HingeLeft},
+	{ID:20, Name: "Vinyl Like With Double Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutDoublePanel, GatefoldHinge: HingeLeft},
+	{ID:21, Name: "Big Box With Front And Back Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutFrontAndBack, GatefoldHinge: HingeLeft},
+	{ID:22, Name: "Jewel Case", Width: f32(5.59), Height: f32(4.92), Depth: f32(0.41), Shape: BoxShapeJewelCase, GatefoldLayout: GatefoldLayoutNone},
+	{ID:23, Name: "Big Box With Double Gatefold", Shape: BoxShapeCuboid, GatefoldLayout: GatefoldLayoutDoubleFront, GatefoldHinge: HingeLeft},
 }
 
 func FindBoxTypeIDByName(name string) (uint) {
@@ -48,4 +86,14 @@ func FindBoxTypeIDByName(name string) (uint) {
         }
     }
     return 0
-}
\ No newline at end of file
+}
+
+// FindBoxType looks up the seed definition for a box type, for callers that don't have the db row handy
+func FindBoxType(id uint) (*BoxType) {
+    for i := range BoxtypesEnum {
+        if BoxtypesEnum[i].ID == id {
+            return &BoxtypesEnum[i]
+        }
+    }
+    return nil
+}
@@ -32,6 +32,13 @@ type Variant struct{
 	Height					float32 `gorm:"type:float"`
 	Depth					float32 `gorm:"type:float"`
 	ScanNotes				*string	`gorm:"type:text;"`
+	ScanProfile				*string	`gorm:"type:varchar(255);"` // ICC profile(s) the scans were embedded with, before converting to sRGB
+	ColorCalibrated			bool	// Corrected with a ColorChecker scan from the package
+	FrontHash				*uint64	// Perceptual hashes of the front and back scans, for spotting the same box imported twice
+	BackHash				*uint64
+	Palette					*string	`gorm:"type:varchar(255);"` // Dominant colors of the front, #rrggbb biggest first, comma separated
+
+	Items					[]VariantItem
 
 	UserID					uint
 	User					User	`gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
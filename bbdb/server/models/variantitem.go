@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Kinds of things that come in the box
+const (
+	ItemManual				= "manual"
+	ItemFloppy				= "floppy"
+	ItemCD					= "cd"
+	ItemMap					= "map"
+	ItemClothMap			= "cloth_map"
+	ItemBadge				= "badge"
+	ItemRegistrationCard	= "registration_card"
+)
+
+// Typical sizes for each kind, used when an item's info.json leaves them out
+var ItemKindDefaults = map[string][3]float32{
+	ItemManual:				{5.5, 8.5, 0.15},
+	ItemFloppy:				{3.5, 3.7, 0.13},
+	ItemCD:					{4.72, 4.72, 0.05},
+	ItemMap:				{8.5, 11, 0.01},
+	ItemClothMap:			{10, 10, 0.02},
+	ItemBadge:				{1.5, 1.5, 0.1},
+	ItemRegistrationCard:	{6, 4, 0.01},
+}
+
+// VariantItem is something packed inside a variant's box, with its own scans and glb
+type VariantItem struct{
+	ID						uint
+
+	VariantID				uint	`gorm:"uniqueIndex:idx_variant_item;"`
+	Variant					Variant	`gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	Slug					string	`gorm:"type:varchar(255);not null;uniqueIndex:idx_variant_item;"` // Folder name in the import, also the glb name
+	Kind					string	`gorm:"type:varchar(32);not null;"`
+	Name					string	`gorm:"type:varchar(255);"`
+
+	Width					float32 `gorm:"type:float"`
+	Height					float32 `gorm:"type:float"`
+	Depth					float32 `gorm:"type:float"`
+	Pages					int		// Manuals only, scanned inside pages
+	SortOrder				int
+
+	CreatedAt 				time.Time
+	UpdatedAt 				time.Time
+}
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"math"
+
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+const (
+	GatefoldOpenSeconds = 1.0 // How long one flap takes to swing open
+	GatefoldOpenAngle   = 180 // Flaps open all the way, flat against the table
+)
+
+// hingedNode is a pivot node in the document and the flap hanging off it
+type hingedNode struct {
+	Node int
+	Part *MeshPart
+}
+
+// hingeRotation is the quaternion (x, y, z, w) for a flap swung open by angle degrees.
+// Hinges are named as seen looking at the face the flap is on, so back flaps turn
+// the other way round the x axis.
+func hingeRotation(part *MeshPart, angle float64) [4]float32 {
+	back := part.Pivot[2] < 0
+
+	axis := [3]float64{0, 1, 0}
+	sign := -1.0
+	switch part.Hinge {
+	case models.HingeRight:
+		sign = 1
+	case models.HingeTop:
+		axis = [3]float64{1, 0, 0}
+		if back {
+			sign = 1
+		}
+	}
+
+	half := sign * angle * math.Pi / 360
+	s := math.Sin(half)
+	return [4]float32{float32(axis[0] * s), float32(axis[1] * s), float32(axis[2] * s), float32(math.Cos(half))}
+}
+
+// writeOpenSampler writes the keyframes for one flap opening, waiting its turn if it's
+// tucked under another flap. There's a keyframe halfway so viewers can't take the short way round.
+func writeOpenSampler(doc *gltf.Document, part *MeshPart) (input, output int) {
+	start := float32(part.OpenStep) * GatefoldOpenSeconds
+
+	var times []float32
+	var rotations [][4]float32
+	if start > 0 {
+		times = append(times, 0)
+		rotations = append(rotations, hingeRotation(part, 0))
+	}
+	times = append(times, start, start+GatefoldOpenSeconds/2, start+GatefoldOpenSeconds)
+	rotations = append(rotations,
+		hingeRotation(part, 0),
+		hingeRotation(part, GatefoldOpenAngle/2),
+		hingeRotation(part, GatefoldOpenAngle))
+
+	input = modeler.WriteAccessor(doc, gltf.TargetNone, times)
+	// Input accessors need their range set
+	doc.Accessors[input].Min = []float64{float64(times[0])}
+	doc.Accessors[input].Max = []float64{float64(times[len(times)-1])}
+	output = modeler.WriteAccessor(doc, gltf.TargetNone, rotations)
+	return input, output
+}
+
+// addOpenAnimations adds the "open_front", "open_back" and "open_all" clips so any glTF
+// viewer can play the gatefolds opening. Clips with nothing to open are left out.
+func addOpenAnimations(doc *gltf.Document, hinged []hingedNode) {
+	if len(hinged) == 0 {
+		return
+	}
+
+	// Keyframes are the same whichever clip a flap is in, so only write them once
+	type keyframes struct{ input, output int }
+	written := make(map[int]keyframes)
+	for _, hn := range hinged {
+		in, out := writeOpenSampler(doc, hn.Part)
+		written[hn.Node] = keyframes{in, out}
+	}
+
+	clips := []struct {
+		name    string
+		include func(*MeshPart) bool
+	}{
+		{"open_front", func(p *MeshPart) bool { return p.Pivot[2] >= 0 }},
+		{"open_back", func(p *MeshPart) bool { return p.Pivot[2] < 0 }},
+		{"open_all", func(p *MeshPart) bool { return true }},
+	}
+
+	for _, clip := range clips {
+		anim := &gltf.Animation{Name: clip.name}
+		for _, hn := range hinged {
+			if !clip.include(hn.Part) {
+				continue
+			}
+			kf := written[hn.Node]
+			anim.Samplers = append(anim.Samplers, &gltf.AnimationSampler{
+				Input:         kf.input,
+				Output:        kf.output,
+				Interpolation: gltf.InterpolationLinear,
+			})
+			anim.Channels = append(anim.Channels, &gltf.AnimationChannel{
+				Sampler: len(anim.Samplers) - 1,
+				Target: gltf.AnimationChannelTarget{
+					Node: gltf.Index(hn.Node),
+					Path: gltf.TRSRotation,
+				},
+			})
+		}
+		if len(anim.Channels) > 0 {
+			doc.Animations = append(doc.Animations, anim)
+		}
+	}
+}
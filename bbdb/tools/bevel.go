@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"math"
+)
+
+// bevelFace is one flat face of a cuboid before it gets rounded off.
+// Corners and UVs go bottom-left, bottom-right, top-right, top-left as seen from outside,
+// the same order addQuad takes them in.
+type bevelFace struct {
+	Corners [4][3]float32
+	UVs     [][2]float32
+	Normal  [3]float32
+}
+
+// bevelSample is one row/column of a beveled face grid
+type bevelSample struct {
+	frac  float32 // How far across the face texture we are, 0-1
+	angle float64 // How far round the bevel we are, 0 on the flat and 45 degrees at the fold
+	side  float32 // Which edge we're rounding towards, -1 or 1
+}
+
+// clampBevel keeps the bevel radius sane for the box size, thin boxes get a smaller bevel
+func clampBevel(radius float32, half [3]float32) float32 {
+	if radius <= 0 {
+		return 0
+	}
+	limit := min(half[0], half[1], half[2]) * 0.5
+	return min(radius, limit)
+}
+
+// bevelSamples splits one axis of a face into the samples for a grid. Each edge of the
+// face gets half of the quarter round bevel, the other half belongs to the neighbouring face.
+// The outer r of the texture is stretched round the bevel by arc length so the printed edge
+// lands on the fold and no artwork gets cut off.
+func bevelSamples(length, r float32, segments int) []bevelSample {
+	half := max(1, (segments+1)/2)
+	edge := r / length
+
+	var samples []bevelSample
+	for i := 0; i <= half; i++ {
+		a := 45 * (1 - float64(i)/float64(half))
+		samples = append(samples, bevelSample{frac: edge * float32(1-a/45), angle: a, side: -1})
+	}
+	for i := 0; i <= half; i++ {
+		a := 45 * float64(i) / float64(half)
+		samples = append(samples, bevelSample{frac: 1 - edge*float32(1-a/45), angle: a, side: 1})
+	}
+	return samples
+}
+
+// addBeveledBox adds a cuboid with rounded edges and corners. half is the half size of the box,
+// r the bevel radius and segments how many steps each quarter round edge is split into.
+// Every face is built as a grid so the normals stay smooth round the bevel and meet their
+// neighbour's exactly at the fold.
+func addBeveledBox(mesh *MeshPart, half [3]float32, r float32, segments int, faces []bevelFace) {
+	segments = min(segments, MaxBevelSegments)
+	inner := [3]float32{half[0] - r, half[1] - r, half[2] - r}
+
+	for _, face := range faces {
+		p0 := face.Corners[0]
+		uAxis := sub3(face.Corners[1], p0)
+		vAxis := sub3(face.Corners[3], p0)
+		uHat := normalize3(uAxis)
+		vHat := normalize3(vAxis)
+
+		uSamples := bevelSamples(length3(uAxis), r, segments)
+		vSamples := bevelSamples(length3(vAxis), r, segments)
+
+		baseIdx := uint16(len(mesh.Positions))
+		for _, vs := range vSamples {
+			for _, us := range uSamples {
+				// Where this sample would be on the flat face, pulled in onto the inner box
+				flat := add3(p0, add3(scale3(uAxis, us.frac), scale3(vAxis, vs.frac)))
+				var core [3]float32
+				for i := range core {
+					core[i] = min(inner[i], flat[i])
+					if core[i] < -inner[i] {
+						core[i] = -inner[i]
+					}
+				}
+
+				// Lean the normal towards whichever edges we're rounding
+				dir := face.Normal
+				dir = add3(dir, scale3(uHat, us.side*float32(math.Tan(us.angle*math.Pi/180))))
+				dir = add3(dir, scale3(vHat, vs.side*float32(math.Tan(vs.angle*math.Pi/180))))
+				dir = normalize3(dir)
+
+				mesh.Positions = append(mesh.Positions, add3(core, scale3(dir, r)))
+				mesh.Normals = append(mesh.Normals, dir)
+				mesh.UVs = append(mesh.UVs, bilerpUV(face.UVs, us.frac, vs.frac))
+			}
+		}
+
+		cols := uint16(len(uSamples))
+		for j := uint16(0); j < uint16(len(vSamples))-1; j++ {
+			for i := uint16(0); i < cols-1; i++ {
+				a := baseIdx + j*cols + i
+				b := a + 1
+				c := a + cols + 1
+				d := a + cols
+				mesh.Indices = append(mesh.Indices, a, b, c, a, c, d)
+			}
+		}
+	}
+}
+
+// bilerpUV finds the atlas UV at s,t across a face from its four corner UVs
+func bilerpUV(uvs [][2]float32, s, t float32) [2]float32 {
+	var out [2]float32
+	for i := range out {
+		out[i] = (1-s)*(1-t)*uvs[0][i] + s*(1-t)*uvs[1][i] + s*t*uvs[2][i] + (1-s)*t*uvs[3][i]
+	}
+	return out
+}
+
+func add3(a, b [3]float32) [3]float32 {
+	return [3]float32{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func sub3(a, b [3]float32) [3]float32 {
+	return [3]float32{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func scale3(a [3]float32, s float32) [3]float32 {
+	return [3]float32{a[0] * s, a[1] * s, a[2] * s}
+}
+
+func length3(a [3]float32) float32 {
+	return float32(math.Sqrt(float64(a[0]*a[0] + a[1]*a[1] + a[2]*a[2])))
+}
+
+func normalize3(a [3]float32) [3]float32 {
+	l := length3(a)
+	if l == 0 {
+		return a
+	}
+	return scale3(a, 1/l)
+}
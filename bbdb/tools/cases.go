@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+const (
+	JewelShellThickness     = 0.04  // Clear plastic walls
+	JewelHingeWidth         = 0.25  // The hinge strip down the left side
+	KeepCaseSleeveThickness = 0.02  // Clear sleeve the cover slides into
+	caseSurfaceGap          = 0.005 // Keeps printed paper off the plastic so it doesn't z-fight
+)
+
+// addCuboid adds an untextured axis aligned box between lo and hi, for plastic bits
+func addCuboid(mesh *MeshPart, lo, hi [3]float32) {
+	v := [][3]float32{
+		{lo[0], lo[1], hi[2]}, // 0
+		{hi[0], lo[1], hi[2]}, // 1
+		{hi[0], hi[1], hi[2]}, // 2
+		{lo[0], hi[1], hi[2]}, // 3
+		{lo[0], lo[1], lo[2]}, // 4
+		{hi[0], lo[1], lo[2]}, // 5
+		{hi[0], hi[1], lo[2]}, // 6
+		{lo[0], hi[1], lo[2]}, // 7
+	}
+	noUV := [][2]float32{{0, 0}, {0, 0}, {0, 0}, {0, 0}}
+
+	addQuad(mesh, [][3]float32{v[0], v[1], v[2], v[3]}, noUV, [3]float32{0, 0, 1})
+	addQuad(mesh, [][3]float32{v[5], v[4], v[7], v[6]}, noUV, [3]float32{0, 0, -1})
+	addQuad(mesh, [][3]float32{v[1], v[5], v[6], v[2]}, noUV, [3]float32{1, 0, 0})
+	addQuad(mesh, [][3]float32{v[4], v[0], v[3], v[7]}, noUV, [3]float32{-1, 0, 0})
+	addQuad(mesh, [][3]float32{v[3], v[2], v[6], v[7]}, noUV, [3]float32{0, 1, 0})
+	addQuad(mesh, [][3]float32{v[4], v[5], v[1], v[0]}, noUV, [3]float32{0, -1, 0})
+}
+
+// generateJewelCaseGeometry builds a CD jewel case: a clear shell with a hinge down the left,
+// a black tray, the booklet behind the lid and the inlay card wrapped around the back of the tray.
+// Node names: "Lid", "Booklet", "Shell", "Hinge", "Tray", "Inlay"
+func generateJewelCaseGeometry(gameInfo *GameInfo, faceUVs func(name string) [][2]float32) []*MeshPart {
+	w := gameInfo.Width / 2.0
+	h := gameInfo.Height / 2.0
+	d := gameInfo.Depth / 2.0
+
+	t := float32(JewelShellThickness)
+	hw := min(float32(JewelHingeWidth), gameInfo.Width*0.1)
+	gap := float32(caseSurfaceGap)
+
+	// Inside edge of the hinge, everything but the hinge itself starts here
+	x0 := -w + hw
+	lidPivot := [3]float32{x0, 0, d}
+
+	// The lid and the booklet clipped into it swing open together
+	lid := &MeshPart{Name: "Lid", Hinge: models.HingeLeft, Pivot: lidPivot, Material: MaterialClearPlastic}
+	addCuboid(lid, [3]float32{x0, -h, d - t}, [3]float32{w, h, d})
+
+	booklet := &MeshPart{Name: "Booklet", Hinge: models.HingeLeft, Pivot: lidPivot}
+	bz := d - t - gap
+	addQuad(booklet, [][3]float32{
+		{x0, -h + t, bz},
+		{w - t, -h + t, bz},
+		{w - t, h - t, bz},
+		{x0, h - t, bz},
+	}, faceUVs("front"), [3]float32{0, 0, 1})
+
+	// Base and the top/bottom walls the lid closes onto
+	shell := &MeshPart{Name: "Shell", Material: MaterialClearPlastic}
+	addCuboid(shell, [3]float32{x0, -h, -d}, [3]float32{w, h, -d + t})
+	addCuboid(shell, [3]float32{x0, h - t, -d + t}, [3]float32{w, h, d - t})
+	addCuboid(shell, [3]float32{x0, -h, -d + t}, [3]float32{w, -h + t, d - t})
+
+	hinge := &MeshPart{Name: "Hinge", Material: MaterialClearPlastic}
+	addCuboid(hinge, [3]float32{-w, -h, -d}, [3]float32{x0, h, d})
+
+	tray := &MeshPart{Name: "Tray", Material: MaterialBlackPlastic}
+	addCuboid(tray, [3]float32{x0 + gap, -h + t, -d + t + gap*2}, [3]float32{w - t - gap, h - t, d - t - gap*2})
+
+	// Inlay card, the back and both spines show through the shell
+	inlay := &MeshPart{Name: "Inlay"}
+	iz := -d + t + gap
+	addQuad(inlay, [][3]float32{
+		{w - t, -h + t, iz},
+		{x0, -h + t, iz},
+		{x0, h - t, iz},
+		{w - t, h - t, iz},
+	}, faceUVs("back"), [3]float32{0, 0, -1})
+	addQuad(inlay, [][3]float32{
+		{x0, -h + t, iz},
+		{x0, -h + t, d - t},
+		{x0, h - t, d - t},
+		{x0, h - t, iz},
+	}, faceUVs("left"), [3]float32{-1, 0, 0})
+	addQuad(inlay, [][3]float32{
+		{w - t, -h + t, d - t},
+		{w - t, -h + t, iz},
+		{w - t, h - t, iz},
+		{w - t, h - t, d - t},
+	}, faceUVs("right"), [3]float32{1, 0, 0})
+
+	// Opaque parts first, blended ones last so naive renderers draw them in a sane order
+	return []*MeshPart{tray, inlay, booklet, shell, hinge, lid}
+}
+
+// generateKeepCaseGeometry builds a DVD keep case: a black plastic case with the printed cover
+// wrapped around the front, spine and back, all inside a clear sleeve.
+// Node names: "Case", "Cover", "Sleeve"
+func generateKeepCaseGeometry(gameInfo *GameInfo, faceUVs func(name string) [][2]float32) []*MeshPart {
+	w := gameInfo.Width / 2.0
+	h := gameInfo.Height / 2.0
+	d := gameInfo.Depth / 2.0
+
+	s := float32(KeepCaseSleeveThickness)
+	gap := float32(caseSurfaceGap)
+
+	caseMesh := &MeshPart{Name: "Case", Material: MaterialBlackPlastic}
+	addCuboid(caseMesh, [3]float32{-w + s, -h, -d + s}, [3]float32{w, h, d - s})
+
+	// Cover sits just off the case so it doesn't fight with the plastic
+	cover := &MeshPart{Name: "Cover"}
+	fz := d - s + gap
+	addQuad(cover, [][3]float32{
+		{-w + s, -h, fz},
+		{w, -h, fz},
+		{w, h, fz},
+		{-w + s, h, fz},
+	}, faceUVs("front"), [3]float32{0, 0, 1})
+	addQuad(cover, [][3]float32{
+		{w, -h, -fz},
+		{-w + s, -h, -fz},
+		{-w + s, h, -fz},
+		{w, h, -fz},
+	}, faceUVs("back"), [3]float32{0, 0, -1})
+	sx := -w + s - gap
+	addQuad(cover, [][3]float32{
+		{sx, -h, -fz},
+		{sx, -h, fz},
+		{sx, h, fz},
+		{sx, h, -fz},
+	}, faceUVs("left"), [3]float32{-1, 0, 0})
+
+	sleeve := &MeshPart{Name: "Sleeve", Material: MaterialClearPlastic}
+	addCuboid(sleeve, [3]float32{-w + s, -h, d - s}, [3]float32{w, h, d})
+	addCuboid(sleeve, [3]float32{-w + s, -h, -d}, [3]float32{w, h, -d + s})
+	addCuboid(sleeve, [3]float32{-w, -h, -d}, [3]float32{-w + s, h, d})
+
+	return []*MeshPart{caseMesh, cover, sleeve}
+}
@@ -0,0 +1,390 @@
+package tools
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/disintegration/imaging"
+)
+
+// An import can bring a scan of an X-Rite ColorChecker Classic done on the same scanner, landscape
+// with the brown patch top left. It gets used to correct every other scan in the package.
+var CalibrationFiles = []string{"calibration.tif", "calibration.webp"}
+
+const CalibrationMaxError = 20 // Mean 0-255 error after fitting, past this it probably isn't a ColorChecker
+
+// ColorChecker Classic patches in sRGB, left to right, top to bottom
+var colorCheckerSRGB = [24][3]uint8{
+	{115, 82, 68}, {194, 150, 130}, {98, 122, 157}, {87, 108, 67}, {133, 128, 177}, {103, 189, 170},
+	{214, 126, 44}, {80, 91, 166}, {193, 90, 99}, {94, 60, 108}, {157, 188, 64}, {224, 163, 46},
+	{56, 61, 150}, {70, 148, 73}, {175, 54, 60}, {231, 199, 31}, {187, 86, 149}, {8, 133, 161},
+	{243, 243, 242}, {200, 200, 200}, {160, 160, 160}, {122, 122, 121}, {85, 85, 85}, {52, 52, 52},
+}
+
+// ICCProfile is what we keep of a scan's embedded profile
+type ICCProfile struct {
+	Description string
+	ColorSpace  string // RGB, GRAY, CMYK...
+}
+
+// IsSRGB is a guess off the name, which is all anything writes sRGB profiles consistently with
+func (p *ICCProfile) IsSRGB() bool {
+	return p == nil || strings.Contains(strings.ToLower(p.Description), "srgb")
+}
+
+// ReadICCProfile pulls the embedded profile out of a TIFF or WebP, nil if there isn't one
+func ReadICCProfile(path string) (*ICCProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tif", ".tiff":
+		data, err = tiffICC(f)
+	case ".webp":
+		data, err = webpICC(f)
+	}
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return parseICC(data)
+}
+
+// tiffICC reads tag 34675 out of the first IFD
+func tiffICC(r io.ReaderAt) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF")
+	}
+	if order.Uint16(header[2:]) != 42 {
+		return nil, nil // BigTIFF, scanners don't write it for a box face
+	}
+
+	ifd := int64(order.Uint32(header[4:]))
+	countBuf := make([]byte, 2)
+	if _, err := r.ReadAt(countBuf, ifd); err != nil {
+		return nil, err
+	}
+	entries := make([]byte, 12*int(order.Uint16(countBuf)))
+	if _, err := r.ReadAt(entries, ifd+2); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(entries); i += 12 {
+		if order.Uint16(entries[i:]) != 34675 {
+			continue
+		}
+		size := order.Uint32(entries[i+4:])
+		if size <= 4 {
+			return nil, nil
+		}
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, int64(order.Uint32(entries[i+8:]))); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// webpICC finds the ICCP chunk in an extended WebP
+func webpICC(r io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP")
+	}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, nil
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		if string(chunk[:4]) == "ICCP" {
+			data := make([]byte, size)
+			_, err := io.ReadFull(r, data)
+			return data, err
+		}
+		if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseICC reads the color space from the header and the name from the desc tag, v2 or v4
+func parseICC(data []byte) (*ICCProfile, error) {
+	if len(data) < 132 {
+		return nil, fmt.Errorf("ICC profile too short")
+	}
+	p := &ICCProfile{ColorSpace: strings.TrimSpace(string(data[16:20]))}
+
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count && 132+i*12+12 <= len(data); i++ {
+		entry := data[132+i*12:]
+		if string(entry[:4]) != "desc" {
+			continue
+		}
+		off, size := int(binary.BigEndian.Uint32(entry[4:])), int(binary.BigEndian.Uint32(entry[8:]))
+		if off+size > len(data) || size < 12 {
+			break
+		}
+		tag := data[off : off+size]
+		switch string(tag[:4]) {
+		case "desc":
+			n := int(binary.BigEndian.Uint32(tag[8:]))
+			if 12+n <= len(tag) {
+				p.Description = strings.TrimRight(string(tag[12:12+n]), "\x00")
+			}
+		case "mluc":
+			// First record is good enough, they're all the same name in different languages
+			if len(tag) >= 28 {
+				n, at := int(binary.BigEndian.Uint32(tag[20:])), int(binary.BigEndian.Uint32(tag[24:]))
+				if at+n <= len(tag) {
+					units := make([]uint16, n/2)
+					for j := range units {
+						units[j] = binary.BigEndian.Uint16(tag[at+j*2:])
+					}
+					p.Description = strings.TrimRight(string(utf16.Decode(units)), "\x00")
+				}
+			}
+		}
+		break
+	}
+	return p, nil
+}
+
+// convertToSRGB converts a scan to sRGB in place if its embedded profile is anything else.
+// Needed before anything rewrites it in Go, the encoders there drop the profile.
+func convertToSRGB(path string) error {
+	profile, err := ReadICCProfile(path)
+	if err != nil || profile.IsSRGB() {
+		return err
+	}
+
+	ext := filepath.Ext(path)
+	tmp := strings.TrimSuffix(path, ext) + ".srgb" + ext
+	out := tmp
+	if strings.ToLower(ext) == ".webp" {
+		out += "[lossless]"
+	}
+	if output, err := exec.Command("vips", "icc_transform", path, out, "srgb", "--embedded").CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("vips icc_transform: %v: %s", err, output)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ColorCalibration is a 3x3 matrix in linear light fitted from a ColorChecker scan
+type ColorCalibration struct {
+	Matrix [3][3]float64
+	Before float64 // Mean patch error before and after correcting, 0-255
+	After  float64
+}
+
+// LoadCalibration finds the chart in a calibration scan and fits the matrix that takes its
+// patches closest to the reference values
+func LoadCalibration(path string) (*ColorCalibration, error) {
+	// Work on a copy, the scan is needed as it came in the package
+	tmp, err := os.CreateTemp("", "calibration-*"+filepath.Ext(path))
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if _, err := Copy(path, tmp.Name()); err != nil {
+		return nil, err
+	}
+	if err := convertToSRGB(tmp.Name()); err != nil {
+		return nil, err
+	}
+
+	src, err := imaging.Open(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	chart := imaging.Clone(src)
+	if quad, ok := detectFace(src); ok && !quadFillsImage(quad, src.Bounds().Size()) {
+		w, h := quadSize(quad)
+		chart = warpQuad(chart, quad, w, h)
+	}
+	if chart.Bounds().Dy() > chart.Bounds().Dx() {
+		chart = imaging.Rotate90(chart)
+	}
+
+	// Upside down on the scanner is easy to do, try it both ways
+	var best *ColorCalibration
+	for _, c := range []*image.NRGBA{chart, imaging.Rotate180(chart)} {
+		cal, err := fitCalibration(sampleColorChecker(c))
+		if err == nil && (best == nil || cal.After < best.After) {
+			best = cal
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("couldn't fit a correction to %s", filepath.Base(path))
+	}
+	if best.After > CalibrationMaxError {
+		return nil, fmt.Errorf("%s doesn't look like a ColorChecker, still off by %.1f after fitting", filepath.Base(path), best.After)
+	}
+	return best, nil
+}
+
+// sampleColorChecker averages the middle of each cell of a 6x4 grid, in linear light
+func sampleColorChecker(img *image.NRGBA) [24][3]float64 {
+	var out [24][3]float64
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	for i := range out {
+		cx, cy := (float64(i%6)+0.5)*w/6, (float64(i/6)+0.5)*h/4
+		rx, ry := int(w/6*0.15), int(h/4*0.15) // Stay well away from the black borders between patches
+
+		var sum [3]float64
+		n := 0
+		for y := int(cy) - ry; y <= int(cy)+ry; y++ {
+			for x := int(cx) - rx; x <= int(cx)+rx; x++ {
+				p := img.PixOffset(x, y)
+				for c := 0; c < 3; c++ {
+					sum[c] += srgbToLinear(img.Pix[p+c])
+				}
+				n++
+			}
+		}
+		for c := range sum {
+			out[i][c] = sum[c] / float64(n)
+		}
+	}
+	return out
+}
+
+// fitCalibration solves each output channel by least squares against the measured patches
+func fitCalibration(measured [24][3]float64) (*ColorCalibration, error) {
+	var ref [24][3]float64
+	for i, p := range colorCheckerSRGB {
+		for c := range p {
+			ref[i][c] = srgbToLinear(p[c])
+		}
+	}
+
+	var ata [3][3]float64
+	for _, m := range measured {
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				ata[r][c] += m[r] * m[c]
+			}
+		}
+	}
+	inv, ok := invert3(ata)
+	if !ok {
+		return nil, fmt.Errorf("patches are all the same color")
+	}
+
+	cal := &ColorCalibration{}
+	for out := 0; out < 3; out++ {
+		var atb [3]float64
+		for i, m := range measured {
+			for c := 0; c < 3; c++ {
+				atb[c] += m[c] * ref[i][out]
+			}
+		}
+		for c := 0; c < 3; c++ {
+			cal.Matrix[out][c] = inv[c][0]*atb[0] + inv[c][1]*atb[1] + inv[c][2]*atb[2]
+		}
+	}
+
+	identity := &ColorCalibration{Matrix: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+	for i, m := range measured {
+		cal.Before += patchError(identity.apply(m), colorCheckerSRGB[i])
+		cal.After += patchError(cal.apply(m), colorCheckerSRGB[i])
+	}
+	cal.Before /= 24
+	cal.After /= 24
+	return cal, nil
+}
+
+func (cal *ColorCalibration) apply(lin [3]float64) [3]float64 {
+	var out [3]float64
+	for r := 0; r < 3; r++ {
+		out[r] = cal.Matrix[r][0]*lin[0] + cal.Matrix[r][1]*lin[1] + cal.Matrix[r][2]*lin[2]
+	}
+	return out
+}
+
+func patchError(lin [3]float64, want [3]uint8) float64 {
+	var sum float64
+	for c := range lin {
+		d := float64(linearToSRGB(lin[c])) - float64(want[c])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// Apply corrects an sRGB image, alpha is left alone
+func (cal *ColorCalibration) Apply(img image.Image) *image.NRGBA {
+	out := imaging.Clone(img)
+	var toLinear [256]float64
+	for i := range toLinear {
+		toLinear[i] = srgbToLinear(uint8(i))
+	}
+	for i := 0; i+3 < len(out.Pix); i += 4 {
+		px := out.Pix[i : i+3]
+		c := cal.apply([3]float64{toLinear[px[0]], toLinear[px[1]], toLinear[px[2]]})
+		px[0], px[1], px[2] = linearToSRGB(c[0]), linearToSRGB(c[1]), linearToSRGB(c[2])
+	}
+	return out
+}
+
+func srgbToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(f float64) uint8 {
+	f = math.Max(0, math.Min(1, f))
+	if f <= 0.0031308 {
+		f *= 12.92
+	} else {
+		f = 1.055*math.Pow(f, 1/2.4) - 0.055
+	}
+	return uint8(f*255 + 0.5)
+}
+
+func invert3(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return [3][3]float64{}, false
+	}
+	var inv [3][3]float64
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			// Cofactor of the transposed position
+			r1, r2 := (c+1)%3, (c+2)%3
+			c1, c2 := (r+1)%3, (r+2)%3
+			inv[r][c] = (m[r1][c1]*m[r2][c2] - m[r1][c2]*m[r2][c1]) / det
+		}
+	}
+	return inv, true
+}
@@ -0,0 +1,427 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/disintegration/imaging"
+)
+
+// testICC builds a profile with just a header and the given tags, in order
+func testICC(colorSpace string, tags map[string][]byte, order ...string) []byte {
+	header := make([]byte, 128)
+	copy(header[16:20], colorSpace)
+	copy(header[36:40], "acsp")
+
+	table := make([]byte, 4+12*len(order))
+	binary.BigEndian.PutUint32(table, uint32(len(order)))
+	var data []byte
+	offset := len(header) + len(table)
+	for i, sig := range order {
+		entry := table[4+i*12:]
+		copy(entry, sig)
+		binary.BigEndian.PutUint32(entry[4:], uint32(offset+len(data)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(tags[sig])))
+		data = append(data, tags[sig]...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+
+	out := append(header, table...)
+	out = append(out, data...)
+	binary.BigEndian.PutUint32(out, uint32(len(out)))
+	return out
+}
+
+// v2 textDescriptionType, the ASCII part is all parseICC reads
+func descTag(name string) []byte {
+	tag := make([]byte, 12, 12+len(name)+1+78)
+	copy(tag, "desc")
+	binary.BigEndian.PutUint32(tag[8:], uint32(len(name)+1))
+	tag = append(tag, name...)
+	tag = append(tag, 0)
+	return append(tag, make([]byte, 78)...) // Empty Unicode and ScriptCode parts
+}
+
+// v4 multiLocalizedUnicodeType, one record per name
+func mlucTag(names ...string) []byte {
+	tag := make([]byte, 16+12*len(names))
+	copy(tag, "mluc")
+	binary.BigEndian.PutUint32(tag[8:], uint32(len(names)))
+	binary.BigEndian.PutUint32(tag[12:], 12)
+	for i, name := range names {
+		units := utf16.Encode([]rune(name))
+		record := 16 + i*12
+		copy(tag[record:], "enUS")
+		binary.BigEndian.PutUint32(tag[record+4:], uint32(len(units)*2))
+		binary.BigEndian.PutUint32(tag[record+8:], uint32(len(tag)))
+		for _, u := range units {
+			tag = binary.BigEndian.AppendUint16(tag, u)
+		}
+	}
+	return tag
+}
+
+func TestParseICC(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        []byte
+		description string
+		colorSpace  string
+		srgb        bool
+		err         bool
+	}{
+		{
+			name:        "v2 desc",
+			data:        testICC("RGB ", map[string][]byte{"desc": descTag("sRGB IEC61966-2.1")}, "desc"),
+			description: "sRGB IEC61966-2.1",
+			colorSpace:  "RGB",
+			srgb:        true,
+		},
+		{
+			name:        "v2 desc after other tags",
+			data:        testICC("RGB ", map[string][]byte{"wtpt": make([]byte, 20), "cprt": descTag("Copyright"), "desc": descTag("Adobe RGB (1998)")}, "wtpt", "cprt", "desc"),
+			description: "Adobe RGB (1998)",
+			colorSpace:  "RGB",
+		},
+		{
+			name:        "v4 mluc",
+			data:        testICC("RGB ", map[string][]byte{"desc": mlucTag("Display P3")}, "desc"),
+			description: "Display P3",
+			colorSpace:  "RGB",
+		},
+		{
+			name:        "v4 mluc takes the first record",
+			data:        testICC("RGB ", map[string][]byte{"desc": mlucTag("sRGB built-in", "sRGB intégré")}, "desc"),
+			description: "sRGB built-in",
+			colorSpace:  "RGB",
+			srgb:        true,
+		},
+		{
+			name:        "v4 mluc outside ASCII",
+			data:        testICC("RGB ", map[string][]byte{"desc": mlucTag("Écran Ünïcode")}, "desc"),
+			description: "Écran Ünïcode",
+			colorSpace:  "RGB",
+		},
+		{
+			name:        "grey",
+			data:        testICC("GRAY", map[string][]byte{"desc": descTag("Gray Gamma 2.2")}, "desc"),
+			description: "Gray Gamma 2.2",
+			colorSpace:  "GRAY",
+		},
+		{
+			name:       "no desc",
+			data:       testICC("CMYK", map[string][]byte{"wtpt": make([]byte, 20)}, "wtpt"),
+			colorSpace: "CMYK",
+		},
+		{
+			name:       "desc runs off the end",
+			data:       testICC("RGB ", map[string][]byte{"desc": descTag("sRGB")}, "desc")[:150],
+			colorSpace: "RGB",
+		},
+		{
+			name: "too short",
+			data: make([]byte, 100),
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := parseICC(c.data)
+			if c.err {
+				if err == nil {
+					t.Fatalf("want an error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Description != c.description {
+				t.Errorf("description %q, want %q", p.Description, c.description)
+			}
+			if p.ColorSpace != c.colorSpace {
+				t.Errorf("color space %q, want %q", p.ColorSpace, c.colorSpace)
+			}
+			if p.IsSRGB() != c.srgb {
+				t.Errorf("IsSRGB() = %v, want %v", p.IsSRGB(), c.srgb)
+			}
+		})
+	}
+}
+
+// testTIFF is a header and one IFD with a width tag and, if profile isn't nil, an ICC tag
+func testTIFF(order binary.AppendByteOrder, profile []byte) []byte {
+	var b []byte
+	if order == binary.LittleEndian {
+		b = append(b, "II"...)
+	} else {
+		b = append(b, "MM"...)
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+
+	entries := 1
+	if profile != nil {
+		entries++
+	}
+	b = order.AppendUint16(b, uint16(entries))
+
+	// ImageWidth, SHORT, 1, 100
+	b = order.AppendUint16(b, 256)
+	b = order.AppendUint16(b, 3)
+	b = order.AppendUint32(b, 1)
+	b = order.AppendUint16(b, 100)
+	b = order.AppendUint16(b, 0)
+
+	dataAt := 8 + 2 + entries*12 + 4
+	if profile != nil {
+		b = order.AppendUint16(b, 34675)
+		b = order.AppendUint16(b, 7) // UNDEFINED
+		b = order.AppendUint32(b, uint32(len(profile)))
+		b = order.AppendUint32(b, uint32(dataAt))
+	}
+	b = order.AppendUint32(b, 0) // No next IFD
+	return append(b, profile...)
+}
+
+func TestTiffICC(t *testing.T) {
+	profile := testICC("RGB ", map[string][]byte{"desc": descTag("ProPhoto RGB")}, "desc")
+
+	cases := []struct {
+		name string
+		data []byte
+		want []byte
+		err  bool
+	}{
+		{"little endian", testTIFF(binary.LittleEndian, profile), profile, false},
+		{"big endian", testTIFF(binary.BigEndian, profile), profile, false},
+		{"no profile", testTIFF(binary.LittleEndian, nil), nil, false},
+		{"bigtiff", append([]byte("II\x2b\x00"), make([]byte, 12)...), nil, false},
+		{"not a tiff", []byte("RIFF\x00\x00\x00\x00WEBP"), nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := tiffICC(bytes.NewReader(c.data))
+			if c.err {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, c.want) {
+				t.Errorf("got %d bytes, want %d", len(got), len(c.want))
+			}
+		})
+	}
+
+	// And all the way through to the name
+	p, err := tiffICC(bytes.NewReader(testTIFF(binary.BigEndian, profile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseICC(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Description != "ProPhoto RGB" || parsed.IsSRGB() {
+		t.Errorf("got %+v", parsed)
+	}
+}
+
+func TestWebpICC(t *testing.T) {
+	profile := testICC("RGB ", map[string][]byte{"desc": mlucTag("Display P3")}, "desc")
+	chunk := func(fourcc string, data []byte) []byte {
+		b := append([]byte(fourcc), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		b = append(b, data...)
+		if len(data)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	riff := func(chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		for _, c := range chunks {
+			body = append(body, c...)
+		}
+		return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		want []byte
+		err  bool
+	}{
+		{"after vp8x", riff(chunk("VP8X", make([]byte, 10)), chunk("ICCP", profile), chunk("VP8L", make([]byte, 5))), profile, false},
+		{"after an odd sized chunk", riff(chunk("EXIF", make([]byte, 7)), chunk("ICCP", profile)), profile, false},
+		{"simple webp", riff(chunk("VP8L", make([]byte, 5))), nil, false},
+		{"not a webp", testTIFF(binary.LittleEndian, nil), nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := webpICC(bytes.NewReader(c.data))
+			if c.err {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, c.want) {
+				t.Errorf("got %d bytes, want %d", len(got), len(c.want))
+			}
+		})
+	}
+}
+
+func mulVec3(m [3][3]float64, v [3]float64) [3]float64 {
+	var out [3]float64
+	for r := 0; r < 3; r++ {
+		out[r] = m[r][0]*v[0] + m[r][1]*v[1] + m[r][2]*v[2]
+	}
+	return out
+}
+
+func TestFitCalibration(t *testing.T) {
+	cases := []struct {
+		name   string
+		matrix [3][3]float64 // The correction the fit should come back with
+	}{
+		{"identity", [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}},
+		{"exposure", [3][3]float64{{1.2, 0, 0}, {0, 1.2, 0}, {0, 0, 1.2}}},
+		{"warm scanner", [3][3]float64{{0.9, 0, 0}, {0, 1, 0}, {0, 0, 1.15}}},
+		{"crosstalk", [3][3]float64{{1.1, -0.08, 0.02}, {-0.03, 1.05, -0.04}, {0.01, -0.06, 1.12}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// A scanner that's off by the inverse of the correction
+			scanner, ok := invert3(c.matrix)
+			if !ok {
+				t.Fatal("test matrix isn't invertible")
+			}
+			var measured [24][3]float64
+			for i, p := range colorCheckerSRGB {
+				measured[i] = mulVec3(scanner, [3]float64{srgbToLinear(p[0]), srgbToLinear(p[1]), srgbToLinear(p[2])})
+			}
+
+			cal, err := fitCalibration(measured)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for r := 0; r < 3; r++ {
+				for col := 0; col < 3; col++ {
+					if math.Abs(cal.Matrix[r][col]-c.matrix[r][col]) > 1e-9 {
+						t.Fatalf("matrix %v, want %v", cal.Matrix, c.matrix)
+					}
+				}
+			}
+			if cal.After > 0.5 {
+				t.Errorf("still off by %.2f after fitting", cal.After)
+			}
+			if cal.After > cal.Before {
+				t.Errorf("fitting made it worse, %.2f before and %.2f after", cal.Before, cal.After)
+			}
+		})
+	}
+
+	t.Run("one color", func(t *testing.T) {
+		var measured [24][3]float64
+		for i := range measured {
+			measured[i] = [3]float64{0.2, 0.2, 0.2}
+		}
+		if _, err := fitCalibration(measured); err == nil {
+			t.Error("want an error when every patch is the same")
+		}
+	})
+}
+
+// A whole chart scanned through a known color error, flipped upside down like it's easy to do
+func TestLoadCalibration(t *testing.T) {
+	correction := [3][3]float64{{1.1, -0.08, 0.02}, {-0.03, 1.05, -0.04}, {0.01, -0.06, 1.12}}
+	scanner, _ := invert3(correction)
+
+	const cell, gutter = 60, 8
+	chart := imaging.New(6*cell, 4*cell, color.NRGBA{20, 20, 20, 255})
+	for i, p := range colorCheckerSRGB {
+		lin := mulVec3(scanner, [3]float64{srgbToLinear(p[0]), srgbToLinear(p[1]), srgbToLinear(p[2])})
+		patch := imaging.New(cell-2*gutter, cell-2*gutter, color.NRGBA{linearToSRGB(lin[0]), linearToSRGB(lin[1]), linearToSRGB(lin[2]), 255})
+		chart = imaging.Paste(chart, patch, image.Pt(i%6*cell+gutter, i/6*cell+gutter))
+	}
+	path := filepath.Join(t.TempDir(), "calibration.png")
+	if err := imaging.Save(imaging.Rotate180(chart), path); err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := LoadCalibration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			// The scan got rounded to 8 bits, so close is as good as it gets
+			if math.Abs(cal.Matrix[r][c]-correction[r][c]) > 0.02 {
+				t.Fatalf("matrix %v, want about %v", cal.Matrix, correction)
+			}
+		}
+	}
+	if cal.After > 1 || cal.Before < 5 {
+		t.Errorf("off by %.2f before and %.2f after", cal.Before, cal.After)
+	}
+}
+
+func TestInvert3(t *testing.T) {
+	cases := []struct {
+		name string
+		m    [3][3]float64
+		ok   bool
+	}{
+		{"identity", [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, true},
+		{"diagonal", [3][3]float64{{2, 0, 0}, {0, 4, 0}, {0, 0, 0.5}}, true},
+		{"general", [3][3]float64{{2, -1, 0}, {-1, 2, -1}, {0, -1, 2}}, true},
+		{"permutation", [3][3]float64{{0, 1, 0}, {0, 0, 1}, {1, 0, 0}}, true},
+		{"singular", [3][3]float64{{1, 2, 3}, {2, 4, 6}, {1, 0, 1}}, false},
+		{"zero", [3][3]float64{}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inv, ok := invert3(c.m)
+			if ok != c.ok {
+				t.Fatalf("ok = %v, want %v", ok, c.ok)
+			}
+			if !ok {
+				return
+			}
+			for r := 0; r < 3; r++ {
+				for col := 0; col < 3; col++ {
+					var sum float64
+					for k := 0; k < 3; k++ {
+						sum += c.m[r][k] * inv[k][col]
+					}
+					want := 0.0
+					if r == col {
+						want = 1
+					}
+					if math.Abs(sum-want) > 1e-12 {
+						t.Fatalf("m * inverse = %v at [%d][%d], want %v", sum, r, col, want)
+					}
+				}
+			}
+		})
+	}
+}
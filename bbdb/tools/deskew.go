@@ -0,0 +1,401 @@
+package tools
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	DeskewBackgroundTolerance = 48   // How far (0-255, any channel) a pixel can be from the scanner background and still count as background
+	DeskewMinCoverage         = 0.2  // Less of the scan than this and it probably found a smudge, not the box
+	DeskewAspectTolerance     = 0.05 // Warn when a straightened face is off from the declared size by more than this
+	DeskewSurroundShare       = 0.9  // How much of the scan around the face has to be background for it to get cropped
+	deskewSkipTolerance       = 0.005
+	deskewDetectSize          = 800 // Detection runs on a copy this big, the warp is full size
+)
+
+// faceQuad is where a face sits in its scan, top left then clockwise, in pixels
+type faceQuad [4][2]float64
+
+type deskewedScan struct {
+	quad   faceQuad
+	bounds image.Point // Size of the scan the quad was found in
+	skip   bool        // Already straight and tight
+}
+
+// DeskewScans finds each face against the scanner background, straightens it and crops to it,
+// overwriting the scans in place. Surface maps get the same correction as the face they belong to.
+// Returns a warning for anything it couldn't find or that doesn't match the declared size.
+func DeskewScans(paths []string, gWidth, gHeight, gDepth float32) ([]string, error) {
+	var warnings []string
+	found := make(map[string]deskewedScan)
+
+	var maps []string
+	for _, p := range paths {
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".tif" && ext != ".tiff" && ext != ".webp" {
+			continue
+		}
+		if _, _, ok := splitSurfaceMap(p); ok {
+			maps = append(maps, p)
+			continue
+		}
+
+		// Saving it back would drop the profile, so it has to be sRGB first
+		if err := convertToSRGB(p); err != nil {
+			return warnings, fmt.Errorf("failed to convert %s to sRGB: %w", filepath.Base(p), err)
+		}
+		img, err := imaging.Open(p)
+		if err != nil {
+			return warnings, fmt.Errorf("failed to open %s: %w", filepath.Base(p), err)
+		}
+		quad, ok := detectFace(img)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s: couldn't tell the box from the background, assuming it's already cropped", filepath.Base(p)))
+		}
+
+		scan := deskewedScan{quad: quad, bounds: img.Bounds().Size(), skip: !ok || quadFillsImage(quad, img.Bounds().Size())}
+
+		// On a scan that's already cropped the biggest blob can just be a patch of the artwork, even
+		// one the right shape, so only crop when what's around it really is scanner lid
+		if !scan.skip && !surroundedByBackground(img, quad) {
+			warnings = append(warnings, fmt.Sprintf("%s: what's around the face isn't background, assuming it's already cropped", filepath.Base(p)))
+			scan.skip = true
+		}
+		found[textureStem(p)] = scan
+
+		out := img
+		if !scan.skip {
+			w, h := quadSize(quad)
+			out = warpQuad(imaging.Clone(img), quad, w, h)
+			if err := saveScan(out, p); err != nil {
+				return warnings, fmt.Errorf("failed to save %s: %w", filepath.Base(p), err)
+			}
+		}
+
+		if warning := checkAspect(filepath.Base(p), out.Bounds().Size(), gWidth, gHeight, gDepth); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	for _, p := range maps {
+		stem, _, _ := splitSurfaceMap(p)
+		scan, ok := found[stem]
+		if !ok || scan.skip {
+			continue
+		}
+		img, err := imaging.Open(p)
+		if err != nil {
+			return warnings, fmt.Errorf("failed to open %s: %w", filepath.Base(p), err)
+		}
+
+		// Maps don't have to be scanned at the same resolution as their face
+		size := img.Bounds().Size()
+		sx, sy := float64(size.X)/float64(scan.bounds.X), float64(size.Y)/float64(scan.bounds.Y)
+		var quad faceQuad
+		for i, c := range scan.quad {
+			quad[i] = [2]float64{c[0] * sx, c[1] * sy}
+		}
+		w, h := quadSize(quad)
+		if err := saveScan(warpQuad(imaging.Clone(img), quad, w, h), p); err != nil {
+			return warnings, fmt.Errorf("failed to save %s: %w", filepath.Base(p), err)
+		}
+	}
+
+	return warnings, nil
+}
+
+// detectFace finds the biggest blob that isn't scanner background and takes its four extreme corners
+func detectFace(img image.Image) (faceQuad, bool) {
+	small := imaging.Fit(img, deskewDetectSize, deskewDetectSize, imaging.Box)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return faceQuad{}, false
+	}
+
+	bg := borderColor(small)
+	mask := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := small.PixOffset(x, y)
+			px := small.Pix[i : i+3]
+			for c := 0; c < 3; c++ {
+				if absInt(int(px[c])-int(bg[c])) > DeskewBackgroundTolerance {
+					mask[y*w+x] = true
+					break
+				}
+			}
+		}
+	}
+
+	blob := largestBlob(mask, w, h)
+	if float64(len(blob)) < DeskewMinCoverage*float64(w*h) {
+		return faceQuad{}, false
+	}
+
+	// Pixel edges, not centers, so a face that fills the scan gives back the scan's corners
+	tl, tr, br, bl := math.Inf(1), math.Inf(-1), math.Inf(-1), math.Inf(1)
+	var quad faceQuad
+	for _, i := range blob {
+		x, y := float64(i%w), float64(i/w)
+		if s := x + y; s < tl {
+			tl, quad[0] = s, [2]float64{x, y}
+		}
+		if s := x + 1 - y; s > tr {
+			tr, quad[1] = s, [2]float64{x + 1, y}
+		}
+		if s := x + y + 2; s > br {
+			br, quad[2] = s, [2]float64{x + 1, y + 1}
+		}
+		if s := x - y - 1; s < bl {
+			bl, quad[3] = s, [2]float64{x, y + 1}
+		}
+	}
+
+	size := img.Bounds().Size()
+	sx, sy := float64(size.X)/float64(w), float64(size.Y)/float64(h)
+	for i := range quad {
+		quad[i][0] *= sx
+		quad[i][1] *= sy
+	}
+	return quad, true
+}
+
+// borderColor is the median of the outermost pixels, which should all be scanner lid
+func borderColor(img *image.NRGBA) [3]uint8 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	var channels [3][]uint8
+	add := func(x, y int) {
+		i := img.PixOffset(x, y)
+		for c := 0; c < 3; c++ {
+			channels[c] = append(channels[c], img.Pix[i+c])
+		}
+	}
+	for x := 0; x < w; x++ {
+		add(x, 0)
+		add(x, h-1)
+	}
+	for y := 1; y < h-1; y++ {
+		add(0, y)
+		add(w-1, y)
+	}
+
+	var out [3]uint8
+	for c := range channels {
+		sort.Slice(channels[c], func(a, b int) bool { return channels[c][a] < channels[c][b] })
+		out[c] = channels[c][len(channels[c])/2]
+	}
+	return out
+}
+
+// surroundedByBackground is true when nearly everything outside the quad is the border color,
+// like the lid would be, rather than more artwork
+func surroundedByBackground(img image.Image, quad faceQuad) bool {
+	small := imaging.Fit(img, deskewDetectSize, deskewDetectSize, imaging.Box)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return false
+	}
+	size := img.Bounds().Size()
+	sx, sy := float64(w)/float64(size.X), float64(h)/float64(size.Y)
+	for i := range quad {
+		quad[i][0] *= sx
+		quad[i][1] *= sy
+	}
+
+	bg := borderColor(small)
+	background, total := 0, 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if inQuad(quad, float64(x)+0.5, float64(y)+0.5) {
+				continue
+			}
+			total++
+			i := small.PixOffset(x, y)
+			near := true
+			for c := 0; c < 3; c++ {
+				if absInt(int(small.Pix[i+c])-int(bg[c])) > DeskewBackgroundTolerance {
+					near = false
+					break
+				}
+			}
+			if near {
+				background++
+			}
+		}
+	}
+	return total == 0 || float64(background) >= DeskewSurroundShare*float64(total)
+}
+
+// inQuad is true for points on the inside of every edge, going clockwise
+func inQuad(quad faceQuad, x, y float64) bool {
+	for i := range quad {
+		a, b := quad[i], quad[(i+1)%4]
+		if (b[0]-a[0])*(y-a[1])-(b[1]-a[1])*(x-a[0]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// largestBlob returns the indexes of the biggest 4-connected run of true in mask
+func largestBlob(mask []bool, w, h int) []int {
+	seen := make([]bool, len(mask))
+	var best, stack []int
+	for start := range mask {
+		if !mask[start] || seen[start] {
+			continue
+		}
+		var blob []int
+		seen[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			blob = append(blob, i)
+
+			x, y := i%w, i/w
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n[0] < 0 || n[1] < 0 || n[0] >= w || n[1] >= h {
+					continue
+				}
+				j := n[1]*w + n[0]
+				if mask[j] && !seen[j] {
+					seen[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		if len(blob) > len(best) {
+			best = blob
+		}
+	}
+	return best
+}
+
+// quadFillsImage is true when every corner is within a hair of the scan's own corners
+func quadFillsImage(quad faceQuad, size image.Point) bool {
+	corners := faceQuad{{0, 0}, {float64(size.X), 0}, {float64(size.X), float64(size.Y)}, {0, float64(size.Y)}}
+	tol := deskewSkipTolerance * float64(max(size.X, size.Y))
+	for i := range quad {
+		if math.Abs(quad[i][0]-corners[i][0]) > tol || math.Abs(quad[i][1]-corners[i][1]) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+// quadSize averages opposite edges so no resolution is thrown away
+func quadSize(quad faceQuad) (int, int) {
+	dist := func(a, b [2]float64) float64 { return math.Hypot(b[0]-a[0], b[1]-a[1]) }
+	w := (dist(quad[0], quad[1]) + dist(quad[3], quad[2])) / 2
+	h := (dist(quad[0], quad[3]) + dist(quad[1], quad[2])) / 2
+	return int(math.Round(w)), int(math.Round(h))
+}
+
+// warpQuad maps the quad onto a w x h rectangle. Each output pixel goes through the homography
+// from the unit square to the quad (Heckbert's closed form) and samples the source bilinearly.
+// Normal maps only get moved, not rotated, which is close enough for the few degrees a scan is off.
+func warpQuad(src *image.NRGBA, quad faceQuad, w, h int) *image.NRGBA {
+	x0, y0 := quad[0][0], quad[0][1]
+	x1, y1 := quad[1][0], quad[1][1]
+	x2, y2 := quad[2][0], quad[2][1]
+	x3, y3 := quad[3][0], quad[3][1]
+
+	sx, sy := x0-x1+x2-x3, y0-y1+y2-y3
+	dx1, dx2, dy1, dy2 := x1-x2, x3-x2, y1-y2, y3-y2
+	var g, hh float64
+	if den := dx1*dy2 - dx2*dy1; den != 0 {
+		g = (sx*dy2 - dx2*sy) / den
+		hh = (dx1*sy - sx*dy1) / den
+	}
+	a, b, c := x1-x0+g*x1, x3-x0+hh*x3, x0
+	d, e, f := y1-y0+g*y1, y3-y0+hh*y3, y0
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				v := (float64(y) + 0.5) / float64(h)
+				for x := 0; x < w; x++ {
+					u := (float64(x) + 0.5) / float64(w)
+					z := g*u + hh*v + 1
+					px := (a*u+b*v+c)/z - 0.5
+					py := (d*u+e*v+f)/z - 0.5
+					copy(dst.Pix[dst.PixOffset(x, y):], bilinearNRGBA(src, sw, sh, px, py))
+				}
+			}
+		}()
+	}
+	for y := 0; y < h; y++ {
+		rows <- y
+	}
+	close(rows)
+	wg.Wait()
+	return dst
+}
+
+func bilinearNRGBA(img *image.NRGBA, w, h int, x, y float64) []uint8 {
+	x = math.Max(0, math.Min(x, float64(w-1)))
+	y = math.Max(0, math.Min(y, float64(h-1)))
+	ix, iy := int(x), int(y)
+	ix1, iy1 := min(ix+1, w-1), min(iy+1, h-1)
+	fx, fy := x-float64(ix), y-float64(iy)
+
+	p00 := img.Pix[img.PixOffset(ix, iy):]
+	p10 := img.Pix[img.PixOffset(ix1, iy):]
+	p01 := img.Pix[img.PixOffset(ix, iy1):]
+	p11 := img.Pix[img.PixOffset(ix1, iy1):]
+
+	var out [4]uint8
+	for c := 0; c < 4; c++ {
+		top := float64(p00[c])*(1-fx) + float64(p10[c])*fx
+		bottom := float64(p01[c])*(1-fx) + float64(p11[c])*fx
+		out[c] = uint8(top*(1-fy) + bottom*fy + 0.5)
+	}
+	return out[:]
+}
+
+// checkAspect compares a face's width/height with what its box says it should be
+func checkAspect(filename string, size image.Point, gWidth, gHeight, gDepth float32) string {
+	faceW, faceH := FaceSize(filename, gWidth, gHeight, gDepth)
+	if faceW <= 0 || faceH <= 0 || size.X == 0 || size.Y == 0 {
+		return ""
+	}
+	got := float64(size.X) / float64(size.Y)
+	want := float64(faceW) / float64(faceH)
+	if math.Abs(got/want-1) <= DeskewAspectTolerance {
+		return ""
+	}
+	return fmt.Sprintf("%s: aspect ratio is %.3f but %gx%g in. should be %.3f (%+.1f%%)",
+		filename, got, faceW, faceH, want, (got/want-1)*100)
+}
+
+// saveScan writes a corrected scan back over itself in its own format
+func saveScan(img image.Image, path string) error {
+	if strings.ToLower(filepath.Ext(path)) == ".webp" {
+		return saveAsWebP(img, path)
+	}
+	return imaging.Save(img, path)
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
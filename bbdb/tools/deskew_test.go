@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// testGrid is a checkerboard with a colored quadrant so flips and rotations show
+func testGrid(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{40, 40, 40, 255}
+			if (x/10+y/10)%2 == 0 {
+				c = color.NRGBA{200, 200, 200, 255}
+			}
+			if x < w/2 && y < h/2 {
+				c.R = 255
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// meanDiff is the average channel difference, 0-255
+func meanDiff(a, b *image.NRGBA) float64 {
+	var sum float64
+	for i := range a.Pix {
+		sum += math.Abs(float64(a.Pix[i]) - float64(b.Pix[i]))
+	}
+	return sum / float64(len(a.Pix))
+}
+
+func TestWarpQuad(t *testing.T) {
+	src := testGrid(200, 160)
+
+	cases := []struct {
+		name string
+		quad faceQuad
+		w, h int
+		want *image.NRGBA
+	}{
+		{"whole image", faceQuad{{0, 0}, {200, 0}, {200, 160}, {0, 160}}, 200, 160, src},
+		{"crop", faceQuad{{40, 20}, {140, 20}, {140, 100}, {40, 100}}, 100, 80, imaging.Crop(src, image.Rect(40, 20, 140, 100))},
+		{"double size", faceQuad{{0, 0}, {200, 0}, {200, 160}, {0, 160}}, 400, 320, imaging.Resize(src, 400, 320, imaging.Linear)},
+		{"upside down", faceQuad{{200, 160}, {0, 160}, {0, 0}, {200, 0}}, 200, 160, imaging.Rotate180(src)},
+		{"quarter turn", faceQuad{{0, 160}, {0, 0}, {200, 0}, {200, 160}}, 160, 200, imaging.Rotate270(src)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := warpQuad(src, c.quad, c.w, c.h)
+			if got.Bounds().Dx() != c.w || got.Bounds().Dy() != c.h {
+				t.Fatalf("size %v, want %dx%d", got.Bounds().Size(), c.w, c.h)
+			}
+			if d := meanDiff(got, c.want); d > 4 {
+				t.Errorf("off by %.1f on average", d)
+			}
+		})
+	}
+}
+
+// A face on a white bed gets found the right size however it was put down
+func TestDetectFace(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	face := imaging.New(300, 370, color.NRGBA{30, 90, 160, 255})
+
+	cases := []struct {
+		name  string
+		img   image.Image
+		found bool
+		w, h  int
+	}{
+		{"on the bed", imaging.Paste(imaging.New(500, 600, white), face, image.Pt(80, 100)), true, 300, 370},
+		{"rotated on the bed", imaging.Paste(imaging.New(500, 600, white), imaging.Rotate(face, 4, white), image.Pt(60, 80)), true, 300, 370},
+		{"in the corner", imaging.Paste(imaging.New(500, 600, white), face, image.Pt(0, 0)), true, 300, 370},
+		{"blank bed", imaging.New(500, 600, white), false, 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			quad, ok := detectFace(c.img)
+			if ok != c.found {
+				t.Fatalf("found = %v, want %v", ok, c.found)
+			}
+			if !ok {
+				return
+			}
+			// Detection runs on a smaller copy, so a few pixels either way
+			w, h := quadSize(quad)
+			if math.Abs(float64(w-c.w)) > 6 || math.Abs(float64(h-c.h)) > 6 {
+				t.Errorf("face is %dx%d, want about %dx%d", w, h, c.w, c.h)
+			}
+		})
+	}
+}
+
+func TestDeskewScans(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+
+	// Cropped art with a big flat patch in it, which is the biggest blob but nowhere near the
+	// shape of a 7.5x9.25 front
+	art := testGrid(600, 740)
+	art = imaging.Paste(art, imaging.New(400, 300, white), image.Pt(100, 200))
+
+	face := imaging.New(600, 740, color.NRGBA{30, 90, 160, 255})
+
+	cases := []struct {
+		name    string
+		img     image.Image
+		changed bool
+		w, h    int
+	}{
+		{"rotated on the bed", imaging.Paste(imaging.New(900, 1100, white), imaging.Rotate(face, 3, white), image.Pt(100, 120)), true, 600, 740},
+		{"in the corner of the bed", imaging.Paste(imaging.New(900, 1100, white), face, image.Pt(0, 0)), true, 600, 740},
+		{"already cropped", testGrid(600, 740), false, 600, 740}, // Its red quadrant is exactly the shape of the front
+		{"cropped with a flat patch", art, false, 600, 740},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "front.tif")
+			if err := imaging.Save(c.img, path); err != nil {
+				t.Fatal(err)
+			}
+			before, _ := os.ReadFile(path)
+
+			if _, err := DeskewScans([]string{path}, 7.5, 9.25, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			after, _ := os.ReadFile(path)
+			if changed := string(before) != string(after); changed != c.changed {
+				t.Fatalf("changed = %v, want %v", changed, c.changed)
+			}
+			img, err := imaging.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := img.Bounds().Dx(), img.Bounds().Dy(); math.Abs(float64(w-c.w)) > 8 || math.Abs(float64(h-c.h)) > 8 {
+				t.Errorf("came out %dx%d, want about %dx%d", w, h, c.w, c.h)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	"os"
+	"strings"
+
+	"github.com/disintegration/imaging"
+
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+// All in inches, the SVG is drawn at true scale
+const (
+	DielineMargin   = 0.5
+	DielineGlueTab  = 0.5
+	DielineTabInset = 0.125 // Glue tab corners are cut in by this much
+	DielineGap      = 0.75  // Between the net and the flaps, and between flaps
+	DielineStroke   = 0.01
+	dielineFontSize = 0.18
+)
+
+const (
+	dielineCutColor  = "#e4007c"
+	dielineFoldColor = "#0077cc"
+)
+
+// dielineFlap is a loose gatefold panel, printed both sides and attached by hand
+type dielineFlap struct {
+	Name       string
+	Outside    string // Atlas key for what shows with the box closed
+	Inside     string
+	WidthRatio float32 // Of the box width
+}
+
+// Flaps each gatefold mode needs, by the atlas keys GenerateGLTFBox packs them under
+var dielineFlaps = map[GatefoldMode][]dielineFlap{
+	GatefoldSingleFront:      {{"Front flap", "gatefold_front_inner", "gatefold_front_back", 1}},
+	GatefoldSingleBack:       {{"Back flap", "gatefold_back_inner", "gatefold_back_back", 1}},
+	GatefoldDoubleFront:      {{"Left flap", "gatefold_front_left", "gatefold_front_left_back", 0.5}, {"Right flap", "gatefold_front_right", "gatefold_front_right_back", 0.5}},
+	GatefoldFrontAndBack:     {{"Front flap", "gatefold_front_inner", "gatefold_front_back", 1}, {"Back flap", "gatefold_back_inner", "gatefold_back_back", 1}},
+	GatefoldTrifoldFront:     {{"Front flap", "gatefold_front_inner", "gatefold_front_back", 1}, {"Inner panel", "gatefold_inner_front", "gatefold_inner_back", 1}},
+	GatefoldDoublePanelFront: {{"Front flap", "gatefold_front_inner", "gatefold_front_back", 1}, {"Inner panel", "gatefold_inner_front", "gatefold_inner_back", 1}},
+}
+
+type dielineWriter struct {
+	b     strings.Builder
+	atlas *AtlasResult
+}
+
+// writeDieline lays the box out flat: left, front, right and back in a row with a glue tab,
+// the top and bottom off the front, then any gatefold panels underneath to print double sided.
+func writeDieline(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode GatefoldMode, path string) error {
+	boxType := resolveBoxType(gameInfo)
+	if boxType.Shape != models.BoxShapeCuboid {
+		return fmt.Errorf("no dieline for %s boxes", boxType.Shape)
+	}
+
+	w, h, d := gameInfo.Width, gameInfo.Height, gameInfo.Depth
+	x0, y0 := float32(DielineMargin), float32(DielineMargin)+d
+
+	flaps := dielineFlaps[gatefoldMode]
+	netW := 2*d + 2*w + DielineGlueTab
+	totalW := netW
+	flapsY := y0 + h + d + DielineGap + dielineFontSize
+	totalH := flapsY
+	for _, flap := range flaps {
+		totalW = max32(totalW, 2*w*flap.WidthRatio+DielineGap)
+		totalH += h + DielineGap + dielineFontSize
+	}
+	totalW += 2 * DielineMargin
+	totalH += dielineFontSize * 2
+
+	dw := &dielineWriter{atlas: atlas}
+	fmt.Fprintf(&dw.b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&dw.b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%sin\" height=\"%sin\" viewBox=\"0 0 %s %s\">\n",
+		exportFloat(totalW), exportFloat(totalH), exportFloat(totalW), exportFloat(totalH))
+	fmt.Fprintf(&dw.b, "<title>%s</title>\n", html.EscapeString(gameInfo.Title))
+
+	// Faces first so the lines sit on top
+	dw.face("left", x0, y0, d, h)
+	dw.face("front", x0+d, y0, w, h)
+	dw.face("right", x0+d+w, y0, d, h)
+	dw.face("back", x0+2*d+w, y0, w, h)
+	dw.face("top", x0+d, y0-d, w, d)
+	dw.face("bottom", x0+d, y0+h, w, d)
+
+	tabX := x0 + 2*d + 2*w
+	dw.cut([][2]float32{
+		{x0, y0}, {x0 + d, y0}, {x0 + d, y0 - d}, {x0 + d + w, y0 - d}, {x0 + d + w, y0},
+		{tabX, y0}, {tabX + DielineGlueTab, y0 + DielineTabInset}, {tabX + DielineGlueTab, y0 + h - DielineTabInset}, {tabX, y0 + h},
+		{x0 + d + w, y0 + h}, {x0 + d + w, y0 + h + d}, {x0 + d, y0 + h + d}, {x0 + d, y0 + h}, {x0, y0 + h},
+	})
+	for _, x := range []float32{x0 + d, x0 + d + w, x0 + 2*d + w, tabX} {
+		dw.fold(x, y0, x, y0+h)
+	}
+	dw.fold(x0+d, y0, x0+d+w, y0)
+	dw.fold(x0+d, y0+h, x0+d+w, y0+h)
+
+	y := flapsY
+	for _, flap := range flaps {
+		fw := w * flap.WidthRatio
+		dw.label(x0, y-dielineFontSize/2, flap.Name+", outside")
+		dw.label(x0+fw+DielineGap, y-dielineFontSize/2, flap.Name+", inside (print on the back)")
+		dw.face(flap.Outside, x0, y, fw, h)
+		dw.face(flap.Inside, x0+fw+DielineGap, y, fw, h)
+		dw.cut([][2]float32{{x0, y}, {x0 + fw, y}, {x0 + fw, y + h}, {x0, y + h}})
+		dw.cut([][2]float32{{x0 + fw + DielineGap, y}, {x0 + 2*fw + DielineGap, y}, {x0 + 2*fw + DielineGap, y + h}, {x0 + fw + DielineGap, y + h}})
+		y += h + DielineGap + dielineFontSize
+	}
+
+	dw.label(x0, totalH-dielineFontSize, fmt.Sprintf("%s, %s x %s x %s in. Print at 100%%. Solid lines cut, dashed lines fold.",
+		gameInfo.Title, exportFloat(w), exportFloat(h), exportFloat(d)))
+	dw.b.WriteString("</svg>\n")
+
+	return os.WriteFile(path, []byte(dw.b.String()), 0644)
+}
+
+// face embeds a face cut out of the atlas, stretched to the panel. Missing faces are left blank.
+func (dw *dielineWriter) face(key string, x, y, w, h float32) {
+	pos, ok := dw.atlas.Positions[key]
+	if !ok {
+		return
+	}
+	size := dw.atlas.Sizes[key]
+	crop := imaging.Crop(dw.atlas.Atlas, image.Rect(pos.X, pos.Y, pos.X+size.X, pos.Y+size.Y))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, crop, &jpeg.Options{Quality: 90}); err != nil {
+		return
+	}
+	fmt.Fprintf(&dw.b, "<image x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" preserveAspectRatio=\"none\" href=\"data:image/jpeg;base64,%s\"/>\n",
+		exportFloat(x), exportFloat(y), exportFloat(w), exportFloat(h), base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+func (dw *dielineWriter) cut(points [][2]float32) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = exportFloat(p[0]) + "," + exportFloat(p[1])
+	}
+	fmt.Fprintf(&dw.b, "<polygon points=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"%g\"/>\n",
+		strings.Join(coords, " "), dielineCutColor, DielineStroke)
+}
+
+func (dw *dielineWriter) fold(x1, y1, x2, y2 float32) {
+	fmt.Fprintf(&dw.b, "<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke=\"%s\" stroke-width=\"%g\" stroke-dasharray=\"0.08 0.05\"/>\n",
+		exportFloat(x1), exportFloat(y1), exportFloat(x2), exportFloat(y2), dielineFoldColor, DielineStroke)
+}
+
+func (dw *dielineWriter) label(x, y float32, text string) {
+	fmt.Fprintf(&dw.b, "<text x=\"%s\" y=\"%s\" font-family=\"sans-serif\" font-size=\"%g\">%s</text>\n",
+		exportFloat(x), exportFloat(y), dielineFontSize, html.EscapeString(text))
+}
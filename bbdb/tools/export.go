@@ -0,0 +1,288 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Files GenerateGLTFBox writes for other apps, next to the glbs
+const (
+	USDZFile    = "box.usdz"    // AR Quick Look
+	OBJFile     = "box-obj.zip" // box.obj, box.mtl and the atlas as box.png, for Blender and friends
+	DielineFile = "dieline.svg" // Flat printable template, cuboid boxes only
+)
+
+// ExportFiles are the downloads by the name the variant export endpoint takes
+var ExportFiles = map[string]string{
+	"usdz":    USDZFile,
+	"obj":     OBJFile,
+	"dieline": DielineFile,
+}
+
+// DerivedFiles is everything made off the geometry besides the glbs, some of it optional
+var DerivedFiles = []string{HeroFile, TurntableFile, USDZFile, OBJFile, DielineFile}
+
+// Box units are inches
+const metersPerInch = 0.0254
+
+// writeExports writes every export it can, one failing doesn't stop the others
+func writeExports(gameInfo *GameInfo, parts []*MeshPart, atlas *AtlasResult, gatefoldMode GatefoldMode, outputDir string) {
+	atlasPNG, err := encodePNG(atlas.Atlas)
+	if err != nil {
+		fmt.Printf("Warning: Could not encode atlas for exports: %v\n", err)
+		return
+	}
+
+	if err := writeOBJ(parts, atlasPNG, filepath.Join(outputDir, OBJFile)); err != nil {
+		fmt.Printf("Warning: Could not write OBJ: %v\n", err)
+	}
+	if err := writeUSDZ(parts, atlasPNG, filepath.Join(outputDir, USDZFile)); err != nil {
+		fmt.Printf("Warning: Could not write USDZ: %v\n", err)
+	}
+	if err := writeDieline(gameInfo, atlas, gatefoldMode, filepath.Join(outputDir, DielineFile)); err != nil {
+		fmt.Printf("Warning: Could not write dieline: %v\n", err)
+	}
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// exportFloat keeps the text formats small, six digits is plenty for inches
+func exportFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', 6, 32)
+}
+
+func partMaterialName(part *MeshPart) string {
+	if _, ok := partMaterials[part.Material]; ok {
+		return part.Material
+	}
+	return MaterialAtlas
+}
+
+// usedMaterials lists the materials the parts ask for, in the order they first show up
+func usedMaterials(parts []*MeshPart) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		name := partMaterialName(part)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// writeOBJ zips up box.obj, box.mtl and box.png. OBJ has its UV origin at the bottom, so v flips.
+func writeOBJ(parts []*MeshPart, atlasPNG []byte, zipPath string) error {
+	var obj, mtl strings.Builder
+	obj.WriteString("# BigBoxDB, units are inches\nmtllib box.mtl\n")
+
+	offset := 1 // OBJ indices start at 1 and run across the whole file
+	for _, part := range parts {
+		fmt.Fprintf(&obj, "o %s\n", part.Name)
+		for _, p := range part.Positions {
+			fmt.Fprintf(&obj, "v %s %s %s\n", exportFloat(p[0]), exportFloat(p[1]), exportFloat(p[2]))
+		}
+		for _, uv := range part.UVs {
+			fmt.Fprintf(&obj, "vt %s %s\n", exportFloat(uv[0]), exportFloat(1-uv[1]))
+		}
+		for _, n := range part.Normals {
+			fmt.Fprintf(&obj, "vn %s %s %s\n", exportFloat(n[0]), exportFloat(n[1]), exportFloat(n[2]))
+		}
+		fmt.Fprintf(&obj, "usemtl %s\n", partMaterialName(part))
+		for i := 0; i+2 < len(part.Indices); i += 3 {
+			a, b, c := int(part.Indices[i])+offset, int(part.Indices[i+1])+offset, int(part.Indices[i+2])+offset
+			fmt.Fprintf(&obj, "f %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, b, b, b, c, c, c)
+		}
+		offset += len(part.Positions)
+	}
+
+	for _, name := range usedMaterials(parts) {
+		def := partMaterials[name]
+		fmt.Fprintf(&mtl, "newmtl %s\n", name)
+		fmt.Fprintf(&mtl, "Kd %g %g %g\n", def.Color[0], def.Color[1], def.Color[2])
+		fmt.Fprintf(&mtl, "d %g\n", def.Color[3])
+		fmt.Fprintf(&mtl, "Ns %g\n", (1-def.Roughness)*1000)
+		if def.Textured {
+			mtl.WriteString("map_Kd box.png\n")
+			if def.Blend {
+				mtl.WriteString("map_d box.png\n")
+			}
+		}
+		mtl.WriteString("\n")
+	}
+
+	f, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{"box.obj", []byte(obj.String())},
+		{"box.mtl", []byte(mtl.String())},
+		{"box.png", atlasPNG},
+	} {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeUSDZ writes the parts as a USDA layer with UsdPreviewSurface materials and packs it
+// with the atlas. Flaps are left closed, Quick Look doesn't play the glb's animations anyway.
+func writeUSDZ(parts []*MeshPart, atlasPNG []byte, usdzPath string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#usda 1.0\n(\n    defaultPrim = \"Box\"\n    metersPerUnit = %g\n    upAxis = \"Y\"\n)\n\n", metersPerInch)
+	b.WriteString("def Xform \"Box\" (\n    kind = \"component\"\n)\n{\n")
+
+	b.WriteString("    def Scope \"Materials\"\n    {\n")
+	for _, name := range usedMaterials(parts) {
+		writeUSDMaterial(&b, name, partMaterials[name])
+	}
+	b.WriteString("    }\n")
+
+	for _, part := range parts {
+		def := partMaterials[partMaterialName(part)]
+		fmt.Fprintf(&b, "\n    def Mesh \"%s\"\n    {\n", part.Name)
+		fmt.Fprintf(&b, "        uniform bool doubleSided = %d\n", map[bool]int{false: 0, true: 1}[def.DoubleSided])
+
+		counts := make([]string, len(part.Indices)/3)
+		for i := range counts {
+			counts[i] = "3"
+		}
+		indices := make([]string, len(part.Indices))
+		for i, idx := range part.Indices {
+			indices[i] = strconv.Itoa(int(idx))
+		}
+		fmt.Fprintf(&b, "        int[] faceVertexCounts = [%s]\n", strings.Join(counts, ", "))
+		fmt.Fprintf(&b, "        int[] faceVertexIndices = [%s]\n", strings.Join(indices, ", "))
+		fmt.Fprintf(&b, "        point3f[] points = [%s]\n", usdTuples3(part.Positions))
+		fmt.Fprintf(&b, "        normal3f[] normals = [%s] (\n            interpolation = \"vertex\"\n        )\n", usdTuples3(part.Normals))
+
+		uvs := make([]string, len(part.UVs))
+		for i, uv := range part.UVs {
+			uvs[i] = fmt.Sprintf("(%s, %s)", exportFloat(uv[0]), exportFloat(1-uv[1]))
+		}
+		fmt.Fprintf(&b, "        texCoord2f[] primvars:st = [%s] (\n            interpolation = \"vertex\"\n        )\n", strings.Join(uvs, ", "))
+		b.WriteString("        uniform token subdivisionScheme = \"none\"\n")
+		fmt.Fprintf(&b, "        rel material:binding = </Box/Materials/%s>\n    }\n", partMaterialName(part))
+	}
+	b.WriteString("}\n")
+
+	return writeUSDZPackage(usdzPath, []usdzEntry{
+		{"box.usda", []byte(b.String())},
+		{"box.png", atlasPNG},
+	})
+}
+
+func usdTuples3(vs [][3]float32) string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = fmt.Sprintf("(%s, %s, %s)", exportFloat(v[0]), exportFloat(v[1]), exportFloat(v[2]))
+	}
+	return strings.Join(out, ", ")
+}
+
+func writeUSDMaterial(b *strings.Builder, name string, def materialDef) {
+	path := "/Box/Materials/" + name
+	fmt.Fprintf(b, "        def Material \"%s\"\n        {\n", name)
+	fmt.Fprintf(b, "            token outputs:surface.connect = <%s/Surface.outputs:surface>\n\n", path)
+	b.WriteString("            def Shader \"Surface\"\n            {\n")
+	b.WriteString("                uniform token info:id = \"UsdPreviewSurface\"\n")
+	if def.Textured {
+		fmt.Fprintf(b, "                color3f inputs:diffuseColor.connect = <%s/Texture.outputs:rgb>\n", path)
+		if def.Blend {
+			fmt.Fprintf(b, "                float inputs:opacity.connect = <%s/Texture.outputs:a>\n", path)
+		}
+	} else {
+		fmt.Fprintf(b, "                color3f inputs:diffuseColor = (%g, %g, %g)\n", def.Color[0], def.Color[1], def.Color[2])
+		fmt.Fprintf(b, "                float inputs:opacity = %g\n", def.Color[3])
+	}
+	fmt.Fprintf(b, "                float inputs:roughness = %g\n", def.Roughness)
+	b.WriteString("                float inputs:metallic = 0\n")
+	b.WriteString("                token outputs:surface\n            }\n")
+
+	if def.Textured {
+		b.WriteString("\n            def Shader \"Texture\"\n            {\n")
+		b.WriteString("                uniform token info:id = \"UsdUVTexture\"\n")
+		b.WriteString("                asset inputs:file = @box.png@\n")
+		fmt.Fprintf(b, "                float2 inputs:st.connect = <%s/UV.outputs:result>\n", path)
+		b.WriteString("                token inputs:wrapS = \"clamp\"\n                token inputs:wrapT = \"clamp\"\n")
+		b.WriteString("                float3 outputs:rgb\n                float outputs:a\n            }\n")
+
+		b.WriteString("\n            def Shader \"UV\"\n            {\n")
+		b.WriteString("                uniform token info:id = \"UsdPrimvarReader_float2\"\n")
+		b.WriteString("                string inputs:varname = \"st\"\n")
+		b.WriteString("                float2 outputs:result\n            }\n")
+	}
+	b.WriteString("        }\n")
+}
+
+type usdzEntry struct {
+	Name string
+	Data []byte
+}
+
+// Extra field id usdzip pads with
+const usdzPaddingID = 0x1986
+
+// writeUSDZPackage is a zip with nothing compressed and every file starting on a 64 byte
+// boundary, which is what makes it a usdz. The first file has to be the layer.
+func writeUSDZPackage(path string, entries []usdzEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	offset := 0
+	for _, e := range entries {
+		// Local header is 30 bytes, then the name, then the extra field padding it out
+		headerLen := 30 + len(e.Name)
+		pad := (64 - (offset+headerLen+4)%64) % 64
+		extra := make([]byte, 4+pad)
+		binary.LittleEndian.PutUint16(extra[0:], usdzPaddingID)
+		binary.LittleEndian.PutUint16(extra[2:], uint16(pad))
+
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               e.Name,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(e.Data),
+			CompressedSize64:   uint64(len(e.Data)),
+			UncompressedSize64: uint64(len(e.Data)),
+			Extra:              extra,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(e.Data); err != nil {
+			return err
+		}
+		offset += headerLen + len(extra) + len(e.Data)
+	}
+	return zw.Close()
+}
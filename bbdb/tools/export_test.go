@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteUSDZPackage(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []usdzEntry
+	}{
+		{"one file", []usdzEntry{{"box.usda", []byte("#usda 1.0\n")}}},
+		{"layer and texture", []usdzEntry{{"box.usda", []byte("#usda 1.0\n")}, {"atlas.png", bytes.Repeat([]byte{0x89}, 1000)}}},
+		// Names and sizes that land the next header everywhere in a 64 byte block
+		{"odd sizes", []usdzEntry{
+			{"a.usda", []byte("x")},
+			{"textures/long_name_for_a_texture.png", bytes.Repeat([]byte{1}, 63)},
+			{"b.png", bytes.Repeat([]byte{2}, 64)},
+			{"cc.png", bytes.Repeat([]byte{3}, 65)},
+			{"empty.png", nil},
+			{strings.Repeat("d", 61) + ".png", bytes.Repeat([]byte{4}, 127)},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "box.usdz")
+			if err := writeUSDZPackage(path, c.entries); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := zip.OpenReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			if len(r.File) != len(c.entries) {
+				t.Fatalf("%d files, want %d", len(r.File), len(c.entries))
+			}
+			for i, f := range r.File {
+				want := c.entries[i]
+				if f.Name != want.Name {
+					t.Errorf("file %d is %s, want %s", i, f.Name, want.Name)
+				}
+				if f.Method != zip.Store {
+					t.Errorf("%s is compressed", f.Name)
+				}
+				offset, err := f.DataOffset()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if offset%64 != 0 {
+					t.Errorf("%s starts at %d, not on a 64 byte boundary", f.Name, offset)
+				}
+
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(rc) // Checks the CRC too
+				rc.Close()
+				if err != nil {
+					t.Fatalf("%s: %v", f.Name, err)
+				}
+				if !bytes.Equal(data, want.Data) {
+					t.Errorf("%s has %d bytes, want %d", f.Name, len(data), len(want.Data))
+				}
+			}
+		})
+	}
+}
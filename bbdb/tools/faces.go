@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Every face scan gets resized to these widths for srcset, from the full resolution scan rather
+// than the atlas faces so there's something worth zooming into
+const (
+	FacesDir     = "faces"
+	FaceManifest = "manifest.json"
+	AVIFQuality  = 50
+
+	// Deep zoom tiles, IIIF Image API level 0 so any IIIF viewer can pan around the full scan
+	FaceTileSize    = 512
+	FaceTileQuality = 85
+	FaceTileInfo    = "info.json"
+)
+
+var (
+	DefaultFaceWidths  = []int{320, 640, 1280, 2560}
+	DefaultFaceFormats = []string{"webp", "avif"}
+)
+
+// FaceSizeImage is one width of a face, by format -> url
+type FaceSizeImage struct {
+	Width  int               `json:"w"`
+	Height int               `json:"h"`
+	URLs   map[string]string `json:"urls"`
+}
+
+// FaceImages is every size made of one face, smallest first
+type FaceImages struct {
+	Name   string          `json:"name"`
+	Width  int             `json:"w"` // Of the scan it was made from
+	Height int             `json:"h"`
+	Sizes  []FaceSizeImage `json:"sizes"`
+	Tiles  string          `json:"tiles,omitempty"` // IIIF info.json for the tile pyramid
+}
+
+// FaceWidths reads BBDB_FACE_WIDTHS ("320,640,1280"), falling back to DefaultFaceWidths
+func FaceWidths() []int {
+	v := os.Getenv("BBDB_FACE_WIDTHS")
+	if v == "" {
+		return DefaultFaceWidths
+	}
+	var widths []int
+	for _, s := range strings.Split(v, ",") {
+		if w, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && w > 0 {
+			widths = append(widths, w)
+		}
+	}
+	if len(widths) == 0 {
+		return DefaultFaceWidths
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// FaceFormats reads BBDB_FACE_FORMATS ("webp,avif"), falling back to DefaultFaceFormats
+func FaceFormats() []string {
+	v := os.Getenv("BBDB_FACE_FORMATS")
+	if v == "" {
+		return DefaultFaceFormats
+	}
+	var formats []string
+	for _, s := range strings.Split(v, ",") {
+		if f := strings.ToLower(strings.TrimSpace(s)); f == "webp" || f == "avif" {
+			formats = append(formats, f)
+		}
+	}
+	if len(formats) == 0 {
+		return DefaultFaceFormats
+	}
+	return formats
+}
+
+// FaceTiles is on unless BBDB_FACE_TILES=0, the pyramids take a lot more space than the rest
+func FaceTiles() bool {
+	return os.Getenv("BBDB_FACE_TILES") != "0"
+}
+
+// MakeFaceImages resizes a face scan to every width in FaceWidths that isn't bigger than the scan
+// (or just its own width if they all are) in every format, into outputDir/<face>-<width>.<format>,
+// plus the deep zoom tiles in outputDir/<face>/. urlPrefix is where outputDir gets served from.
+func MakeFaceImages(srcPath, outputDir, urlPrefix string, cal *ColorCalibration) (*FaceImages, error) {
+	name := textureStem(srcPath)
+	srcW, srcH, err := imageSize(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	var widths []int
+	for _, w := range FaceWidths() {
+		if w < srcW {
+			widths = append(widths, w)
+		}
+	}
+	widths = append(widths, srcW)
+	if len(widths) > 1 && widths[len(widths)-2]*5/4 > srcW {
+		widths = widths[:len(widths)-1] // Full size is barely bigger than the last one
+	}
+
+	// The color work only happens once, everything else is resized from this
+	tmpDir, err := os.MkdirTemp("", "face-"+name)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	master := filepath.Join(tmpDir, "master.png")
+	if err := processImageWithVips(srcPath, master, srcW, srcH, true, cal); err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", name, err)
+	}
+
+	img, err := imaging.Open(master)
+	if err != nil {
+		return nil, err
+	}
+
+	face := &FaceImages{Name: name, Width: srcW, Height: srcH}
+	if FaceTiles() {
+		if err := makeFaceTiles(master, filepath.Join(outputDir, name), urlPrefix); err != nil {
+			fmt.Printf("Warning: Could not make tiles for %s: %v\n", name, err)
+		} else {
+			face.Tiles = urlPrefix + "/" + name + "/" + FaceTileInfo
+		}
+	}
+
+	for _, w := range widths {
+		resized := imaging.Resize(img, w, 0, imaging.Lanczos)
+		size := FaceSizeImage{Width: w, Height: resized.Bounds().Dy(), URLs: make(map[string]string)}
+		for _, format := range FaceFormats() {
+			file := fmt.Sprintf("%s-%d.%s", name, w, format)
+			if err := saveImage(resized, filepath.Join(outputDir, file)); err != nil {
+				fmt.Printf("Warning: Could not make %s: %v\n", file, err)
+				continue
+			}
+			size.URLs[format] = urlPrefix + "/" + file
+		}
+		if len(size.URLs) > 0 {
+			face.Sizes = append(face.Sizes, size)
+		}
+	}
+	return face, nil
+}
+
+// makeFaceTiles writes a static IIIF tile pyramid and its info.json into tileDir. The image id
+// has to be a full url for viewers to find the tiles, so it's built off SITE_URL.
+func makeFaceTiles(master, tileDir, urlPrefix string) error {
+	os.RemoveAll(tileDir)
+	output, err := exec.Command("vips", "dzsave", master, tileDir,
+		"--layout", "iiif",
+		"--tile-size", strconv.Itoa(FaceTileSize),
+		"--overlap", "0",
+		"--suffix", fmt.Sprintf(".jpg[Q=%d]", FaceTileQuality),
+		"--id", strings.TrimSuffix(os.Getenv("SITE_URL"), "/")+urlPrefix,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("vips dzsave: %v: %s", err, output)
+	}
+	return nil
+}
+
+// Faces get listed outside first, anything not in here (the gatefolds) after them by name
+var faceOrder = []string{"front", "back", "left", "right", "top", "bottom"}
+
+// WriteFaceManifest saves the face list next to the images
+func WriteFaceManifest(faces []*FaceImages, outputDir string) error {
+	rank := func(name string) int {
+		if i := slices.Index(faceOrder, name); i >= 0 {
+			return i
+		}
+		return len(faceOrder)
+	}
+	sort.SliceStable(faces, func(a, b int) bool {
+		ra, rb := rank(faces[a].Name), rank(faces[b].Name)
+		if ra != rb {
+			return ra < rb
+		}
+		return faces[a].Name < faces[b].Name
+	})
+
+	data, err := json.Marshal(faces)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, FaceManifest), data, 0644)
+}
+
+// ReadFaceManifest loads a variant's face list, nil if it was imported before there were any
+func ReadFaceManifest(outputDir string) []FaceImages {
+	data, err := os.ReadFile(filepath.Join(outputDir, FaceManifest))
+	if err != nil {
+		return nil
+	}
+	var faces []FaceImages
+	if err := json.Unmarshal(data, &faces); err != nil {
+		return nil
+	}
+	return faces
+}
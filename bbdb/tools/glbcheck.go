@@ -0,0 +1,613 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+
+	"github.com/qmuntal/gltf"
+	"github.com/qmuntal/gltf/modeler"
+)
+
+const (
+	GLBSizeTolerance   = 0.02  // Inches the bounding box can be off the declared size
+	GLBNormalTolerance = 0.01  // How far off 1.0 a normal's length can be
+	GLBUVTolerance     = 0.001 // UVs a hair outside 0..1 are just float noise
+)
+
+var ktx2Magic = []byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// glbBounds is an axis aligned box in world space
+type glbBounds struct {
+	Min, Max [3]float64
+	Empty    bool
+}
+
+func newBounds() glbBounds {
+	return glbBounds{
+		Min:   [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)},
+		Max:   [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
+		Empty: true,
+	}
+}
+
+func (b *glbBounds) add(p [3]float64) {
+	for i := range p {
+		b.Min[i] = math.Min(b.Min[i], p[i])
+		b.Max[i] = math.Max(b.Max[i], p[i])
+	}
+	b.Empty = false
+}
+
+func (b glbBounds) size() [3]float64 {
+	if b.Empty {
+		return [3]float64{}
+	}
+	return [3]float64{b.Max[0] - b.Min[0], b.Max[1] - b.Min[1], b.Max[2] - b.Min[2]}
+}
+
+// InspectGLB prints a rundown of a glb: nodes, meshes, images, animations and how
+// its size compares to what it was generated for
+func InspectGLB(path string, w io.Writer) error {
+	doc, err := gltf.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s (%s, %s)\n", path, formatBytes(int(stat.Size())), doc.Asset.Generator)
+
+	world := nodeWorldMatrices(doc)
+	fmt.Fprintln(w, "\nNodes:")
+	for _, scene := range doc.Scenes {
+		for _, n := range scene.Nodes {
+			printNode(w, doc, world, n, 1)
+		}
+	}
+
+	fmt.Fprintln(w, "\nMeshes:")
+	for i, mesh := range doc.Meshes {
+		for j, prim := range mesh.Primitives {
+			verts := 0
+			if pos, ok := prim.Attributes[gltf.POSITION]; ok && pos < len(doc.Accessors) {
+				verts = doc.Accessors[pos].Count
+			}
+			material := "none"
+			if prim.Material != nil && *prim.Material < len(doc.Materials) {
+				material = fmt.Sprintf("%d %s", *prim.Material, doc.Materials[*prim.Material].Name)
+			}
+			fmt.Fprintf(w, "  %d %s [%d]: %d vertices, %d triangles, material %s\n",
+				i, mesh.Name, j, verts, primitiveTriangles(doc, prim), material)
+		}
+	}
+
+	fmt.Fprintln(w, "\nImages:")
+	for i, img := range doc.Images {
+		data := imageData(doc, img)
+		width, height, format := imageDimensions(data)
+		fmt.Fprintf(w, "  %d %s (%s) %dx%d %s\n", i, img.MimeType, format, width, height, formatBytes(len(data)))
+	}
+
+	if len(doc.Animations) > 0 {
+		fmt.Fprintln(w, "\nAnimations:")
+		for _, anim := range doc.Animations {
+			fmt.Fprintf(w, "  %s: %d channels, %.2fs\n", anim.Name, len(anim.Channels), animationLength(doc, anim))
+		}
+	}
+
+	bounds := sceneBounds(doc, world)
+	size := bounds.size()
+	fmt.Fprintf(w, "\nBounds: %.3f x %.3f x %.3f", size[0], size[1], size[2])
+	if declared, ok := declaredSize(doc); ok {
+		fmt.Fprintf(w, " (declared %.3f x %.3f x %.3f)", declared[0], declared[1], declared[2])
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// ValidateGLB checks a glb for the kind of mistakes generateGeometry can make. It only
+// errors if the file can't be read, anything wrong inside it comes back as problems.
+func ValidateGLB(path string) ([]string, error) {
+	doc, err := gltf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return validateDocument(doc), nil
+}
+
+func validateDocument(doc *gltf.Document) []string {
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	for i, bv := range doc.BufferViews {
+		if bv.Buffer >= len(doc.Buffers) {
+			report("bufferView %d: buffer %d doesn't exist", i, bv.Buffer)
+			continue
+		}
+		buf := doc.Buffers[bv.Buffer]
+		if bv.ByteOffset+bv.ByteLength > buf.ByteLength || bv.ByteOffset+bv.ByteLength > len(buf.Data) {
+			report("bufferView %d: bytes %d-%d run past the end of buffer %d (%d bytes)",
+				i, bv.ByteOffset, bv.ByteOffset+bv.ByteLength, bv.Buffer, len(buf.Data))
+		}
+	}
+
+	// Anything that fails here doesn't get read below, the modeler would panic on it
+	goodAccessors := make(map[int]bool)
+	for i, acr := range doc.Accessors {
+		if msg := accessorRangeProblem(doc, acr); msg != "" {
+			report("accessor %d: %s", i, msg)
+			continue
+		}
+		goodAccessors[i] = true
+	}
+
+	for i, mesh := range doc.Meshes {
+		for j, prim := range mesh.Primitives {
+			for _, msg := range validatePrimitive(doc, prim, goodAccessors) {
+				report("mesh %d %s [%d]: %s", i, mesh.Name, j, msg)
+			}
+		}
+	}
+
+	for i, node := range doc.Nodes {
+		if node.Mesh != nil && *node.Mesh >= len(doc.Meshes) {
+			report("node %d %s: mesh %d doesn't exist", i, node.Name, *node.Mesh)
+		}
+		for _, c := range node.Children {
+			if c >= len(doc.Nodes) {
+				report("node %d %s: child %d doesn't exist", i, node.Name, c)
+			}
+		}
+	}
+
+	for i, tex := range doc.Textures {
+		src := textureSource(tex)
+		if src == nil || *src >= len(doc.Images) {
+			report("texture %d: doesn't point at an image", i)
+		}
+	}
+	for i, img := range doc.Images {
+		data := imageData(doc, img)
+		if data == nil {
+			report("image %d: no embedded data", i)
+			continue
+		}
+		if img.MimeType == "image/ktx2" && !bytes.HasPrefix(data, ktx2Magic) {
+			report("image %d: says it's KTX2 but doesn't have the KTX2 header", i)
+		}
+	}
+
+	for _, anim := range doc.Animations {
+		for _, msg := range validateAnimation(doc, anim, goodAccessors) {
+			report("animation %s: %s", anim.Name, msg)
+		}
+	}
+
+	// Only worth comparing when everything above checked out, broken accessors make for a broken box
+	if declared, ok := declaredSize(doc); ok && len(problems) == 0 {
+		size := sceneBounds(doc, nodeWorldMatrices(doc)).size()
+		names := []string{"width", "height"}
+		for axis, name := range names {
+			if math.Abs(size[axis]-declared[axis]) > GLBSizeTolerance {
+				report("%s is %.3f, declared %.3f", name, size[axis], declared[axis])
+			}
+		}
+		// Gatefolds and cardboard flaps stack up in front, so it can only be deeper
+		if size[2] < declared[2]-GLBSizeTolerance {
+			report("depth is %.3f, declared %.3f", size[2], declared[2])
+		}
+	}
+
+	return problems
+}
+
+// accessorRangeProblem says what's wrong with where an accessor points, if anything
+func accessorRangeProblem(doc *gltf.Document, acr *gltf.Accessor) string {
+	if acr.BufferView == nil {
+		return "" // All zeros, nothing to check
+	}
+	if *acr.BufferView >= len(doc.BufferViews) {
+		return fmt.Sprintf("bufferView %d doesn't exist", *acr.BufferView)
+	}
+	if acr.Count == 0 {
+		return "count is 0"
+	}
+	bv := doc.BufferViews[*acr.BufferView]
+	if bv.Buffer >= len(doc.Buffers) || bv.ByteOffset+bv.ByteLength > len(doc.Buffers[bv.Buffer].Data) {
+		return fmt.Sprintf("bufferView %d is broken", *acr.BufferView)
+	}
+	elem := acr.ComponentType.ByteSize() * acr.Type.Components()
+	stride := bv.ByteStride
+	if stride == 0 {
+		stride = elem
+	}
+	end := acr.ByteOffset + (acr.Count-1)*stride + elem
+	if end > bv.ByteLength {
+		return fmt.Sprintf("needs %d bytes but bufferView %d has %d", end, *acr.BufferView, bv.ByteLength)
+	}
+	return ""
+}
+
+func validatePrimitive(doc *gltf.Document, prim *gltf.Primitive, good map[int]bool) []string {
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	posIndex, ok := prim.Attributes[gltf.POSITION]
+	if !ok {
+		return []string{"no POSITION attribute"}
+	}
+	if !good[posIndex] {
+		return []string{"POSITION accessor is broken"}
+	}
+	posAcr := doc.Accessors[posIndex]
+	positions, err := modeler.ReadPosition(doc, posAcr, nil)
+	if err != nil {
+		return []string{fmt.Sprintf("couldn't read POSITION: %v", err)}
+	}
+
+	actual := newBounds()
+	for i, p := range positions {
+		if hasNaN(p[:]) {
+			report("position %d is NaN", i)
+			continue
+		}
+		actual.add([3]float64{float64(p[0]), float64(p[1]), float64(p[2])})
+	}
+	if len(posAcr.Min) != 3 || len(posAcr.Max) != 3 {
+		report("POSITION accessor has no min/max")
+	} else {
+		for axis := 0; axis < 3; axis++ {
+			if math.Abs(posAcr.Min[axis]-actual.Min[axis]) > 1e-4 || math.Abs(posAcr.Max[axis]-actual.Max[axis]) > 1e-4 {
+				report("POSITION min/max %v/%v don't match the data %v/%v", posAcr.Min, posAcr.Max, actual.Min, actual.Max)
+				break
+			}
+		}
+	}
+
+	if prim.Indices != nil {
+		if !good[*prim.Indices] {
+			report("indices accessor is broken")
+		} else if indices, err := modeler.ReadIndices(doc, doc.Accessors[*prim.Indices], nil); err != nil {
+			report("couldn't read indices: %v", err)
+		} else {
+			if prim.Mode == gltf.PrimitiveTriangles && len(indices)%3 != 0 {
+				report("%d indices isn't a whole number of triangles", len(indices))
+			}
+			for i, idx := range indices {
+				if int(idx) >= len(positions) {
+					report("index %d is %d, only %d vertices", i, idx, len(positions))
+					break
+				}
+			}
+		}
+	}
+
+	if nIndex, ok := prim.Attributes[gltf.NORMAL]; ok {
+		if !good[nIndex] {
+			report("NORMAL accessor is broken")
+		} else if normals, err := modeler.ReadNormal(doc, doc.Accessors[nIndex], nil); err != nil {
+			report("couldn't read NORMAL: %v", err)
+		} else {
+			if len(normals) != len(positions) {
+				report("%d normals for %d vertices", len(normals), len(positions))
+			}
+			bad := 0
+			for _, n := range normals {
+				l := math.Sqrt(float64(n[0]*n[0] + n[1]*n[1] + n[2]*n[2]))
+				if hasNaN(n[:]) || math.Abs(l-1) > GLBNormalTolerance {
+					bad++
+				}
+			}
+			if bad > 0 {
+				report("%d normals aren't unit length", bad)
+			}
+		}
+	}
+
+	if uvIndex, ok := prim.Attributes[gltf.TEXCOORD_0]; ok {
+		if !good[uvIndex] {
+			report("TEXCOORD_0 accessor is broken")
+		} else if uvs, err := modeler.ReadTextureCoord(doc, doc.Accessors[uvIndex], nil); err != nil {
+			report("couldn't read TEXCOORD_0: %v", err)
+		} else {
+			if len(uvs) != len(positions) {
+				report("%d UVs for %d vertices", len(uvs), len(positions))
+			}
+			bad := 0
+			for _, uv := range uvs {
+				if hasNaN(uv[:]) || uv[0] < -GLBUVTolerance || uv[0] > 1+GLBUVTolerance || uv[1] < -GLBUVTolerance || uv[1] > 1+GLBUVTolerance {
+					bad++
+				}
+			}
+			if bad > 0 {
+				report("%d UVs are outside 0..1", bad)
+			}
+		}
+	}
+
+	if prim.Material != nil && *prim.Material >= len(doc.Materials) {
+		report("material %d doesn't exist", *prim.Material)
+	}
+	return problems
+}
+
+func validateAnimation(doc *gltf.Document, anim *gltf.Animation, good map[int]bool) []string {
+	var problems []string
+	for i, s := range anim.Samplers {
+		if !good[s.Input] || !good[s.Output] {
+			problems = append(problems, fmt.Sprintf("sampler %d has a broken accessor", i))
+			continue
+		}
+		input, output := doc.Accessors[s.Input], doc.Accessors[s.Output]
+		want := input.Count
+		if s.Interpolation == gltf.InterpolationCubicSpline {
+			want *= 3
+		}
+		if output.Count != want {
+			problems = append(problems, fmt.Sprintf("sampler %d has %d keyframes but %d values", i, input.Count, output.Count))
+		}
+
+		times, err := modeler.ReadAccessor(doc, input, nil)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("couldn't read sampler %d times: %v", i, err))
+			continue
+		}
+		if ts, ok := times.([]float32); ok {
+			for j := 1; j < len(ts); j++ {
+				if ts[j] <= ts[j-1] {
+					problems = append(problems, fmt.Sprintf("sampler %d keyframe times go backwards at %d", i, j))
+					break
+				}
+			}
+		}
+	}
+	for i, c := range anim.Channels {
+		if c.Sampler >= len(anim.Samplers) {
+			problems = append(problems, fmt.Sprintf("channel %d: sampler %d doesn't exist", i, c.Sampler))
+		}
+		if c.Target.Node == nil || *c.Target.Node >= len(doc.Nodes) {
+			problems = append(problems, fmt.Sprintf("channel %d: doesn't target a node", i))
+		}
+	}
+	return problems
+}
+
+func printNode(w io.Writer, doc *gltf.Document, world map[int][16]float64, n, depth int) {
+	if n >= len(doc.Nodes) {
+		return
+	}
+	node := doc.Nodes[n]
+	indent := fmt.Sprintf("%*s", depth*2, "")
+	line := fmt.Sprintf("%s%d %s", indent, n, node.Name)
+	if t := node.TranslationOrDefault(); t != [3]float64{} {
+		line += fmt.Sprintf(" t(%.3f, %.3f, %.3f)", t[0], t[1], t[2])
+	}
+	if node.Mesh != nil && *node.Mesh < len(doc.Meshes) {
+		b := newBounds()
+		addMeshBounds(doc, *node.Mesh, world[n], &b)
+		size := b.size()
+		line += fmt.Sprintf(" mesh %d, %.3f x %.3f x %.3f", *node.Mesh, size[0], size[1], size[2])
+	}
+	fmt.Fprintln(w, line)
+	for _, c := range node.Children {
+		printNode(w, doc, world, c, depth+1)
+	}
+}
+
+// nodeWorldMatrices works out every node's rest pose transform, walking down from the scene roots
+func nodeWorldMatrices(doc *gltf.Document) map[int][16]float64 {
+	world := make(map[int][16]float64)
+	var walk func(n int, parent [16]float64)
+	walk = func(n int, parent [16]float64) {
+		if n >= len(doc.Nodes) {
+			return
+		}
+		if _, seen := world[n]; seen {
+			return // Cycles are broken files, don't hang on them
+		}
+		m := mulMat4(parent, localMatrix(doc.Nodes[n]))
+		world[n] = m
+		for _, c := range doc.Nodes[n].Children {
+			walk(c, m)
+		}
+	}
+	for _, scene := range doc.Scenes {
+		for _, n := range scene.Nodes {
+			walk(n, gltf.DefaultMatrix)
+		}
+	}
+	return world
+}
+
+func sceneBounds(doc *gltf.Document, world map[int][16]float64) glbBounds {
+	b := newBounds()
+	for n, m := range world {
+		if mesh := doc.Nodes[n].Mesh; mesh != nil && *mesh < len(doc.Meshes) {
+			addMeshBounds(doc, *mesh, m, &b)
+		}
+	}
+	return b
+}
+
+func addMeshBounds(doc *gltf.Document, mesh int, m [16]float64, b *glbBounds) {
+	for _, prim := range doc.Meshes[mesh].Primitives {
+		pos, ok := prim.Attributes[gltf.POSITION]
+		if !ok || pos >= len(doc.Accessors) || accessorRangeProblem(doc, doc.Accessors[pos]) != "" {
+			continue
+		}
+		positions, err := modeler.ReadPosition(doc, doc.Accessors[pos], nil)
+		if err != nil {
+			continue
+		}
+		for _, p := range positions {
+			if !hasNaN(p[:]) {
+				b.add(transformPoint(m, p))
+			}
+		}
+	}
+}
+
+// localMatrix is a node's transform in column-major order, from its matrix or its TRS
+func localMatrix(node *gltf.Node) [16]float64 {
+	if node.Matrix != [16]float64{} && node.Matrix != gltf.DefaultMatrix {
+		return node.Matrix
+	}
+	t := node.TranslationOrDefault()
+	q := node.RotationOrDefault()
+	s := node.ScaleOrDefault()
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return [16]float64{
+		(1 - 2*(y*y+z*z)) * s[0], (2 * (x*y + z*w)) * s[0], (2 * (x*z - y*w)) * s[0], 0,
+		(2 * (x*y - z*w)) * s[1], (1 - 2*(x*x+z*z)) * s[1], (2 * (y*z + x*w)) * s[1], 0,
+		(2 * (x*z + y*w)) * s[2], (2 * (y*z - x*w)) * s[2], (1 - 2*(x*x+y*y)) * s[2], 0,
+		t[0], t[1], t[2], 1,
+	}
+}
+
+func mulMat4(a, b [16]float64) [16]float64 {
+	var out [16]float64
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += a[k*4+row] * b[col*4+k]
+			}
+			out[col*4+row] = sum
+		}
+	}
+	return out
+}
+
+func transformPoint(m [16]float64, p [3]float32) [3]float64 {
+	x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+	return [3]float64{
+		m[0]*x + m[4]*y + m[8]*z + m[12],
+		m[1]*x + m[5]*y + m[9]*z + m[13],
+		m[2]*x + m[6]*y + m[10]*z + m[14],
+	}
+}
+
+// declaredSize is the width/height/depth the glb was generated for, see generateGLTFDocument
+func declaredSize(doc *gltf.Document) ([3]float64, bool) {
+	if len(doc.Scenes) == 0 {
+		return [3]float64{}, false
+	}
+	var extras struct {
+		Width, Height, Depth float64
+	}
+	if !decodeLoose(doc.Scenes[0].Extras, &extras) || extras.Width == 0 {
+		return [3]float64{}, false
+	}
+	return [3]float64{extras.Width, extras.Height, extras.Depth}, true
+}
+
+// textureSource is the image a texture uses, KTX2 textures keep it in KHR_texture_basisu
+func textureSource(tex *gltf.Texture) *int {
+	if tex.Source != nil {
+		return tex.Source
+	}
+	var basisu struct {
+		Source *int `json:"source"`
+	}
+	if ext, ok := tex.Extensions["KHR_texture_basisu"]; ok && decodeLoose(ext, &basisu) {
+		return basisu.Source
+	}
+	return nil
+}
+
+// decodeLoose fills out from extras/extensions, which come back as raw JSON or maps depending
+// on whether the glb was loaded or built in memory
+func decodeLoose(v interface{}, out interface{}) bool {
+	if v == nil {
+		return false
+	}
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return false
+		}
+	}
+	return json.Unmarshal(raw, out) == nil
+}
+
+func imageData(doc *gltf.Document, img *gltf.Image) []byte {
+	if img.BufferView == nil || *img.BufferView >= len(doc.BufferViews) {
+		return nil
+	}
+	bv := doc.BufferViews[*img.BufferView]
+	if bv.Buffer >= len(doc.Buffers) {
+		return nil
+	}
+	data := doc.Buffers[bv.Buffer].Data
+	if bv.ByteOffset+bv.ByteLength > len(data) {
+		return nil
+	}
+	return data[bv.ByteOffset : bv.ByteOffset+bv.ByteLength]
+}
+
+// imageDimensions gets the size out of the image header, KTX2 has it at a fixed spot
+func imageDimensions(data []byte) (int, int, string) {
+	if bytes.HasPrefix(data, ktx2Magic) && len(data) >= 28 {
+		return int(binary.LittleEndian.Uint32(data[20:24])), int(binary.LittleEndian.Uint32(data[24:28])), "ktx2"
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, "unknown"
+	}
+	return cfg.Width, cfg.Height, format
+}
+
+func primitiveTriangles(doc *gltf.Document, prim *gltf.Primitive) int {
+	if prim.Mode != gltf.PrimitiveTriangles {
+		return 0
+	}
+	if prim.Indices != nil && *prim.Indices < len(doc.Accessors) {
+		return doc.Accessors[*prim.Indices].Count / 3
+	}
+	if pos, ok := prim.Attributes[gltf.POSITION]; ok && pos < len(doc.Accessors) {
+		return doc.Accessors[pos].Count / 3
+	}
+	return 0
+}
+
+func animationLength(doc *gltf.Document, anim *gltf.Animation) float64 {
+	var length float64
+	for _, s := range anim.Samplers {
+		if s.Input < len(doc.Accessors) && len(doc.Accessors[s.Input].Max) > 0 {
+			length = math.Max(length, doc.Accessors[s.Input].Max[0])
+		}
+	}
+	return length
+}
+
+func hasNaN(v []float32) bool {
+	for _, f := range v {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
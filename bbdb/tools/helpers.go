@@ -78,6 +78,10 @@ type ImportData struct{
 	BBDBVersion		*int	`json:"bbdb_version,omitempty"`
 	ContributedBy	*string	`json:"contributed_by,omitempty"`
 	Links			map[string]string `json:"links,omitempty"`
+	ManualPDF		*bool	`json:"manual_pdf,omitempty"` // Defaults to true when there's a manual/ folder
+	ManualModel		*bool	`json:"manual_model,omitempty"`
+	Deskew			*bool	`json:"deskew,omitempty"` // Straighten and crop scans that still have scanner bed around them
+	AllowDuplicate	*bool	`json:"allow_duplicate,omitempty"` // Import even if the scans look like a box that's already in
 }
 
 type FirstString string
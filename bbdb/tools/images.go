@@ -19,7 +19,7 @@ const (
 	WebPQualiity		= 70
 )
 
-func ProcessImage(srcPath string, dstPath, filename string, gWidth float32, gHeight float32, gDepth float32) error {
+func ProcessImage(srcPath string, dstPath, filename string, gWidth float32, gHeight float32, gDepth float32, cal *ColorCalibration) error {
 	if os.Getenv("APP_ENV") != "production" {
 		fmt.Printf("Processing: %s\n", filename)
 	}
@@ -29,22 +29,30 @@ func ProcessImage(srcPath string, dstPath, filename string, gWidth float32, gHei
     // }
 
 	// Determine thumbnail size
-	var width, height int
+	faceW, faceH := FaceSize(filename, gWidth, gHeight, gDepth)
+	width := int(faceW * UpsizeRatio)
+	height := int(faceH * UpsizeRatio)
+
+	// Surface maps are data, not color, they skip the profile conversion and calibration
+	_, _, isMap := splitSurfaceMap(filename)
+	if isMap {
+		cal = nil
+	}
+
+	return processImageWithVips(srcPath, dstPath, width, height, !isMap, cal)
+}
+
+// FaceSize is how big a scan is on the box in inches, going by its name
+func FaceSize(filename string, gWidth float32, gHeight float32, gDepth float32) (float32, float32) {
 	if strings.HasPrefix(filename, "front") || strings.HasPrefix(filename, "back") ||
-		strings.HasPrefix(filename, "gatefold_"){
-		width = int(gWidth * UpsizeRatio)
-		height = int(gHeight * UpsizeRatio)
+		strings.HasPrefix(filename, "gatefold_") || strings.HasPrefix(filename, "page_"){
+		return gWidth, gHeight
 	} else if strings.HasPrefix(filename, "left") || strings.HasPrefix(filename, "right") {
-		width = int(gDepth * UpsizeRatio)
-		height = int(gHeight * UpsizeRatio)
+		return gDepth, gHeight
 	} else if strings.HasPrefix(filename, "top") || strings.HasPrefix(filename, "bottom") {
-		width = int(gWidth * UpsizeRatio)
-		height = int(gDepth * UpsizeRatio)
+		return gWidth, gDepth
 	}
-
-	processImageWithVips(srcPath, dstPath, width, height)
-
-	return nil
+	return 0, 0
 }
 
 func saveAsWebP(img image.Image, path string) error {
@@ -60,15 +68,34 @@ func saveAsWebP(img image.Image, path string) error {
 	})
 }
 
-func processImageWithVips(srcPath, dstPath string, width, height int) error {
+// processImageWithVips resizes to fit and saves WebP. With manageColor anything carrying a
+// non-sRGB profile gets converted to sRGB (Go's decoders ignore profiles, so those go through vips too)
+func processImageWithVips(srcPath, dstPath string, width, height int, manageColor bool, cal *ColorCalibration) error {
     ext := strings.ToLower(filepath.Ext(srcPath))
-    
-    if ext == ".tif" || ext == ".tiff" {
-        cmd := exec.Command("vipsthumbnail", srcPath,
-            "-o", dstPath+"[Q="+string(WebPQualiity)+"]",
-            "-s", fmt.Sprintf("%dx%d", width, height),
-        )
-        return cmd.Run()
+    profile, _ := ReadICCProfile(srcPath)
+
+    if ext == ".tif" || ext == ".tiff" || (manageColor && !profile.IsSRGB()) {
+        out := vipsOutput(dstPath)
+        if cal != nil {
+            // Lossless in between so the correction doesn't stack on WebP artifacts
+            out = dstPath + ".calibrate.png"
+            defer os.Remove(out)
+        }
+
+        args := []string{srcPath, "-o", out, "-s", fmt.Sprintf("%dx%d", width, height)}
+        if manageColor {
+            args = append(args, "--export-profile", "srgb")
+        }
+        cmd := exec.Command("vipsthumbnail", args...)
+        if err := cmd.Run(); err != nil || cal == nil {
+            return err
+        }
+
+        img, err := imaging.Open(out)
+        if err != nil {
+            return err
+        }
+        return saveImage(cal.Apply(img), dstPath)
     }
     
     img, err := imaging.Open(srcPath)
@@ -76,7 +103,40 @@ func processImageWithVips(srcPath, dstPath string, width, height int) error {
         return err
     }
     resized := imaging.Fit(img, width, height, imaging.Lanczos)
-    return saveAsWebP(resized, dstPath)
+    if cal != nil {
+        resized = cal.Apply(resized)
+    }
+    return saveImage(resized, dstPath)
+}
+
+// vipsOutput tacks the encoder options vips wants onto a path, by format
+func vipsOutput(path string) string {
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".webp":
+        return fmt.Sprintf("%s[Q=%d]", path, WebPQualiity)
+    case ".avif":
+        return fmt.Sprintf("%s[Q=%d]", path, AVIFQuality)
+    }
+    return path
+}
+
+// saveImage picks the encoder by extension, AVIF has to go through vips
+func saveImage(img image.Image, path string) error {
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".webp":
+        return saveAsWebP(img, path)
+    case ".avif":
+        tmp := path + ".png"
+        defer os.Remove(tmp)
+        if err := imaging.Save(img, tmp); err != nil {
+            return err
+        }
+        if output, err := exec.Command("vips", "copy", tmp, vipsOutput(path)).CombinedOutput(); err != nil {
+            return fmt.Errorf("vips copy: %v: %s", err, output)
+        }
+        return nil
+    }
+    return imaging.Save(img, path)
 }
 
 func OptimizeWebPImages(texPaths []string, gWidth float32, gHeight float32) error {
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"errors"
+	"image"
+	"io"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Reverse image search, a photo of a box against every front. Each one gets boiled down to the
+// perceptual hash for its layout plus a tiny grid of average colors, small enough to keep all of
+// them in memory and just compare against every one.
+const (
+	PhotoMaxSize = 1024 // Phone photos get shrunk to this first, nothing here looks at more
+	// Anything bigger is refused before decoding, a small PNG can claim to be huge and decoding
+	// it takes 4 bytes a pixel. 24MP covers any camera people take to flea markets.
+	PhotoMaxPixels = 25_000_000
+
+	colorGridSize = 4
+	// How much the color grid counts next to the hash, which is the more reliable of the two
+	photoColorWeight = 0.3
+)
+
+// Centered crops tried besides the whole photo, for when the box doesn't stand out from what's behind it
+var photoCrops = []float64{0.85, 0.7}
+
+// ImageDescriptor is what a front gets compared by
+type ImageDescriptor struct {
+	Hash   uint64
+	Colors [colorGridSize * colorGridSize * 3]float32
+}
+
+// DescribeImage hashes an image and averages its colors over a 4x4 grid. The colors are divided
+// by their own average per channel, so a yellow flea market light or a dim photo still lines up
+// with the scan.
+func DescribeImage(img image.Image) ImageDescriptor {
+	d := ImageDescriptor{Hash: PerceptualHash(img)}
+
+	grid := imaging.Resize(img, colorGridSize, colorGridSize, imaging.Box)
+	var mean [3]float64
+	for i := 0; i < colorGridSize*colorGridSize; i++ {
+		for c := 0; c < 3; c++ {
+			mean[c] += float64(grid.Pix[i*4+c]) / (colorGridSize * colorGridSize)
+		}
+	}
+	for i := 0; i < colorGridSize*colorGridSize; i++ {
+		for c := 0; c < 3; c++ {
+			d.Colors[i*3+c] = float32(float64(grid.Pix[i*4+c]) / math.Max(mean[c], 1))
+		}
+	}
+	return d
+}
+
+// DescriptorDistance is 0 for the same picture and around 1 for unrelated ones
+func DescriptorDistance(a, b ImageDescriptor) float64 {
+	hash := math.Min(float64(HashDistance(a.Hash, b.Hash))/32, 1)
+
+	var diff float64
+	for i := range a.Colors {
+		diff += math.Abs(float64(a.Colors[i] - b.Colors[i]))
+	}
+	color := math.Min(diff/float64(len(a.Colors))/0.5, 1)
+
+	return (1-photoColorWeight)*hash + photoColorWeight*color
+}
+
+var ErrPhotoTooLarge = errors.New("photo is too large")
+
+// OpenPhoto decodes an uploaded photo the right way up, phones mostly save them sideways with an
+// EXIF orientation. Only the header gets read until the size checks out.
+func OpenPhoto(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > PhotoMaxPixels {
+		return nil, ErrPhotoTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, err := imaging.Decode(r, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+	if b := img.Bounds(); b.Dx() > PhotoMaxSize || b.Dy() > PhotoMaxSize {
+		img = imaging.Fit(img, PhotoMaxSize, PhotoMaxSize, imaging.Box)
+	}
+	return img, nil
+}
+
+// DescribePhoto gives a descriptor for every guess at where the box is in a photo: found against
+// the background like a scan would be, the whole thing, and a couple of centered crops
+func DescribePhoto(img image.Image) []ImageDescriptor {
+	var guesses []ImageDescriptor
+	if face, ok := cropToFace(img); ok {
+		guesses = append(guesses, DescribeImage(face))
+	}
+	guesses = append(guesses, DescribeImage(img))
+
+	b := img.Bounds()
+	for _, f := range photoCrops {
+		guesses = append(guesses, DescribeImage(imaging.CropCenter(img, int(float64(b.Dx())*f), int(float64(b.Dy())*f))))
+	}
+	return guesses
+}
+
+// MatchPhoto is how close the best guess from DescribePhoto is to a front, and its hash distance
+func MatchPhoto(guesses []ImageDescriptor, front ImageDescriptor) (float64, int) {
+	best, bits := math.Inf(1), 64
+	for _, g := range guesses {
+		if d := DescriptorDistance(g, front); d < best {
+			best, bits = d, HashDistance(g.Hash, front.Hash)
+		}
+	}
+	return best, bits
+}
+
+// DescribeFile is DescribeImage for a front on disk
+func DescribeFile(path string) (ImageDescriptor, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return ImageDescriptor{}, err
+	}
+	return DescribeImage(img), nil
+}
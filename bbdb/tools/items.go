@@ -0,0 +1,303 @@
+package tools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/qmuntal/gltf"
+
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+const (
+	ItemAtlasMaxSize = 4096 // Manuals with lots of pages get scaled down to fit
+	DiscSegments     = 64
+	CDHoleRatio      = 0.125 // Centre hole of a CD compared to the whole disc
+)
+
+// PaperColor is the edge of anything printed, and stands in for faces that weren't scanned
+var PaperColor = color.NRGBA{R: 236, G: 232, B: 222, A: 255}
+
+// ImportItemData is the info.json inside an items/<name>/ folder of an import
+type ImportItemData struct {
+	Kind   string  `json:"kind"`
+	Name   string  `json:"name,omitempty"`
+	Width  float32 `json:"width,omitempty"`
+	Height float32 `json:"height,omitempty"`
+	Depth  float32 `json:"depth,omitempty"`
+	Sort   *int    `json:"sort,omitempty"` // Folder name order when it's left out
+}
+
+// Which mesh each kind of item gets
+const (
+	itemMeshSheet  = "sheet"
+	itemMeshDisc   = "disc"
+	itemMeshManual = "manual"
+)
+
+var itemMeshes = map[string]string{
+	models.ItemManual:           itemMeshManual,
+	models.ItemFloppy:           itemMeshSheet,
+	models.ItemCD:               itemMeshDisc,
+	models.ItemMap:              itemMeshSheet,
+	models.ItemClothMap:         itemMeshSheet,
+	models.ItemBadge:            itemMeshDisc,
+	models.ItemRegistrationCard: itemMeshSheet,
+}
+
+// ItemPageNumber returns the page number of a manual page scan like page_12.webp
+func ItemPageNumber(path string) (int, bool) {
+	stem := textureStem(path)
+	if !strings.HasPrefix(stem, "page_") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(stem, "page_"))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// GenerateItemGLB builds item.glb in outputDir for one thing that came in the box.
+// texturePaths are its front/back scans, plus page_N scans for manuals.
+func GenerateItemGLB(item *ImportItemData, texturePaths []string, outputDir string) error {
+	faces := make(map[string]string)
+	for _, path := range texturePaths {
+		faces[textureStem(path)] = path
+	}
+	return generateItemGLB(item, faces, filepath.Join(outputDir, "item.glb"))
+}
+
+// generateItemGLB builds an item's glb from its scans keyed by face: "front", "back" and "page_N"
+func generateItemGLB(item *ImportItemData, faces map[string]string, glbFilename string) error {
+	if _, ok := itemMeshes[item.Kind]; !ok {
+		return fmt.Errorf("unknown item kind '%s'", item.Kind)
+	}
+
+	imagesToPack := map[string]image.Image{
+		"paper": imaging.New(8, 8, PaperColor),
+	}
+	var pages []string
+	for stem, path := range faces {
+		switch {
+		case stem == "front" || stem == "back":
+			imagesToPack[stem] = loadAndResizeImage(path, false)
+		case item.Kind == models.ItemManual:
+			if _, ok := ItemPageNumber(stem); ok {
+				imagesToPack[stem] = loadAndResizeImage(path, false)
+				pages = append(pages, stem)
+			}
+		}
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		a, _ := ItemPageNumber(pages[i])
+		b, _ := ItemPageNumber(pages[j])
+		return a < b
+	})
+
+	// The packer puts two scans to a row, keep the atlas from getting too tall
+	rows := (len(imagesToPack) + 1) / 2
+	tallest := 0
+	for _, img := range imagesToPack {
+		tallest = max(tallest, img.Bounds().Dy())
+	}
+	if scale := float64(ItemAtlasMaxSize) / float64(rows*tallest); scale < 1 {
+		for key, img := range imagesToPack {
+			b := img.Bounds()
+			imagesToPack[key] = imaging.Resize(img, int(math.Max(1, float64(b.Dx())*scale)), 0, imaging.Lanczos)
+		}
+	}
+
+	atlasResult := packTextures(imagesToPack)
+	atlasFilename := filepath.Join(filepath.Dir(glbFilename), randomString(24)+"-atlas.ktx2")
+	if !saveAsKTX2(atlasResult.Atlas, atlasFilename, KTX2Compression, KTX2QualityLow, false) {
+		return fmt.Errorf("Failed to save KTX2 texture atlas")
+	}
+
+	parts := generateItemGeometry(item, atlasResult, pages)
+	doc, err := generateGLTFDocument(&GameInfo{Title: item.Name, Width: item.Width, Height: item.Height, Depth: item.Depth}, parts, atlasTextures{Color: atlasFilename})
+	if err != nil {
+		return fmt.Errorf("failed to build gltf document: %w", err)
+	}
+
+	if err := gltf.SaveBinary(doc, glbFilename); err != nil {
+		return fmt.Errorf("failed to save GLB: %w", err)
+	}
+
+	if os.Getenv("APP_ENV") != "production" {
+		fileInfo, _ := os.Stat(glbFilename)
+		fmt.Printf("Item GLB saved: %s (%.1f KB)\n", glbFilename, float32(fileInfo.Size())/1024)
+	}
+	return nil
+}
+
+// atlasQuadUVs returns the plain UVs of an atlas entry, bottom-left first like addQuad wants.
+// Anything that wasn't scanned gets plain paper.
+func atlasQuadUVs(atlas *AtlasResult, name string) [][2]float32 {
+	pos, ok := atlas.Positions[name]
+	if !ok {
+		name = "paper"
+		pos = atlas.Positions[name]
+	}
+	size := atlas.Sizes[name]
+
+	atlasW := float32(atlas.Dimensions.X)
+	atlasH := float32(atlas.Dimensions.Y)
+	inset := float32(0.5)
+	u0 := (float32(pos.X) + inset) / atlasW
+	u1 := (float32(pos.X+size.X) - inset) / atlasW
+	v0 := (float32(pos.Y) + inset) / atlasH
+	v1 := (float32(pos.Y+size.Y) - inset) / atlasH
+
+	return [][2]float32{{u0, v1}, {u1, v1}, {u1, v0}, {u0, v0}}
+}
+
+// generateItemGeometry builds the mesh for an item, centred on the origin like the boxes
+func generateItemGeometry(item *ImportItemData, atlas *AtlasResult, pages []string) []*MeshPart {
+	w := item.Width / 2
+	h := item.Height / 2
+	d := item.Depth / 2
+
+	front := atlasQuadUVs(atlas, "front")
+	back := atlasQuadUVs(atlas, "back")
+	paper := atlasQuadUVs(atlas, "paper")
+
+	switch itemMeshes[item.Kind] {
+	case itemMeshDisc:
+		hole := float32(0)
+		if item.Kind == models.ItemCD {
+			hole = CDHoleRatio
+		}
+		disc := &MeshPart{Name: "Item"}
+		addDisc(disc, min(w, h), d, hole, front, back, paper)
+		return []*MeshPart{disc}
+
+	case itemMeshManual:
+		return generateManualGeometry(w, h, d, atlas, pages)
+	}
+
+	sheet := &MeshPart{Name: "Item"}
+	addSheet(sheet, [3]float32{-w, -h, -d}, [3]float32{w, h, d}, front, back, paper)
+	return []*MeshPart{sheet}
+}
+
+// generateManualGeometry stacks one leaf per two faces: the cover and page_1, page_2 and
+// page_3... down to the back cover. Every leaf but the last is hinged on the spine so
+// open_front turns the pages one at a time.
+// Node names: "Cover", "Leaf1", "Leaf2"..., "BackCover"
+func generateManualGeometry(w, h, d float32, atlas *AtlasResult, pages []string) []*MeshPart {
+	faces := append([]string{"front"}, pages...)
+	if len(faces)%2 == 0 {
+		faces = append(faces, "paper") // Blank inside of the back cover
+	}
+	faces = append(faces, "back")
+
+	leaves := len(faces) / 2
+	t := 2 * d / float32(leaves)
+	paper := atlasQuadUVs(atlas, "paper")
+
+	var parts []*MeshPart
+	for i := 0; i < leaves; i++ {
+		zHi := d - float32(i)*t
+		leaf := &MeshPart{Name: fmt.Sprintf("Leaf%d", i)}
+		switch i {
+		case 0:
+			leaf.Name = "Cover"
+		case leaves - 1:
+			leaf.Name = "BackCover"
+		}
+
+		// Pivot on the top of the stack so turned leaves pile up in order on the left
+		if i < leaves-1 {
+			leaf.Hinge = models.HingeLeft
+			leaf.Pivot = [3]float32{-w, 0, d}
+			leaf.OpenStep = i
+		}
+
+		addSheet(leaf, [3]float32{-w, -h, zHi - t}, [3]float32{w, h, zHi},
+			atlasQuadUVs(atlas, faces[i*2]), atlasQuadUVs(atlas, faces[i*2+1]), paper)
+		parts = append(parts, leaf)
+	}
+	return parts
+}
+
+// addSheet adds a thin box with its front and back printed and plain edges
+func addSheet(mesh *MeshPart, lo, hi [3]float32, front, back, edge [][2]float32) {
+	v := [][3]float32{
+		{lo[0], lo[1], hi[2]}, // 0
+		{hi[0], lo[1], hi[2]}, // 1
+		{hi[0], hi[1], hi[2]}, // 2
+		{lo[0], hi[1], hi[2]}, // 3
+		{lo[0], lo[1], lo[2]}, // 4
+		{hi[0], lo[1], lo[2]}, // 5
+		{hi[0], hi[1], lo[2]}, // 6
+		{lo[0], hi[1], lo[2]}, // 7
+	}
+
+	addQuad(mesh, [][3]float32{v[0], v[1], v[2], v[3]}, front, [3]float32{0, 0, 1})
+	addQuad(mesh, [][3]float32{v[5], v[4], v[7], v[6]}, back, [3]float32{0, 0, -1})
+	addQuad(mesh, [][3]float32{v[1], v[5], v[6], v[2]}, edge, [3]float32{1, 0, 0})
+	addQuad(mesh, [][3]float32{v[4], v[0], v[3], v[7]}, edge, [3]float32{-1, 0, 0})
+	addQuad(mesh, [][3]float32{v[3], v[2], v[6], v[7]}, edge, [3]float32{0, 1, 0})
+	addQuad(mesh, [][3]float32{v[4], v[5], v[1], v[0]}, edge, [3]float32{0, -1, 0})
+}
+
+// addDisc adds a round disc of radius r and half thickness d, with a hole in the middle
+// holeRatio of the way out. The front and back scans are mapped square onto the disc.
+func addDisc(mesh *MeshPart, r, d, holeRatio float32, front, back, edge [][2]float32) {
+	ri := r * holeRatio
+	edgeUV := bilerpUV(edge, 0.5, 0.5)
+
+	ring := func(radius float32, i int) (float32, float32) {
+		a := 2 * math.Pi * float64(i%DiscSegments) / DiscSegments
+		return radius * float32(math.Cos(a)), radius * float32(math.Sin(a))
+	}
+	// Scans fill the square around the disc, the back is seen from behind so it's mirrored
+	faceUV := func(uvs [][2]float32, x, y, side float32) [2]float32 {
+		return bilerpUV(uvs, side*x/(2*r)+0.5, y/(2*r)+0.5)
+	}
+
+	for i := 0; i < DiscSegments; i++ {
+		ox0, oy0 := ring(r, i)
+		ox1, oy1 := ring(r, i+1)
+		ix0, iy0 := ring(ri, i)
+		ix1, iy1 := ring(ri, i+1)
+
+		// Front and back faces
+		if ri > 0 {
+			addQuad(mesh, [][3]float32{{ix0, iy0, d}, {ox0, oy0, d}, {ox1, oy1, d}, {ix1, iy1, d}},
+				[][2]float32{faceUV(front, ix0, iy0, 1), faceUV(front, ox0, oy0, 1), faceUV(front, ox1, oy1, 1), faceUV(front, ix1, iy1, 1)},
+				[3]float32{0, 0, 1})
+			addQuad(mesh, [][3]float32{{ix1, iy1, -d}, {ox1, oy1, -d}, {ox0, oy0, -d}, {ix0, iy0, -d}},
+				[][2]float32{faceUV(back, ix1, iy1, -1), faceUV(back, ox1, oy1, -1), faceUV(back, ox0, oy0, -1), faceUV(back, ix0, iy0, -1)},
+				[3]float32{0, 0, -1})
+		} else {
+			addTri(mesh, [][3]float32{{0, 0, d}, {ox0, oy0, d}, {ox1, oy1, d}},
+				[][2]float32{faceUV(front, 0, 0, 1), faceUV(front, ox0, oy0, 1), faceUV(front, ox1, oy1, 1)},
+				[3]float32{0, 0, 1})
+			addTri(mesh, [][3]float32{{0, 0, -d}, {ox1, oy1, -d}, {ox0, oy0, -d}},
+				[][2]float32{faceUV(back, 0, 0, -1), faceUV(back, ox1, oy1, -1), faceUV(back, ox0, oy0, -1)},
+				[3]float32{0, 0, -1})
+		}
+
+		// Outside rim, and the inside of the hole
+		mid := 2 * math.Pi * (float64(i) + 0.5) / DiscSegments
+		nx, ny := float32(math.Cos(mid)), float32(math.Sin(mid))
+		rimUV := [][2]float32{edgeUV, edgeUV, edgeUV, edgeUV}
+		addQuad(mesh, [][3]float32{{ox0, oy0, -d}, {ox1, oy1, -d}, {ox1, oy1, d}, {ox0, oy0, d}},
+			rimUV, [3]float32{nx, ny, 0})
+		if ri > 0 {
+			addQuad(mesh, [][3]float32{{ix1, iy1, -d}, {ix0, iy0, -d}, {ix0, iy0, d}, {ix1, iy1, d}},
+				rimUV, [3]float32{-nx, -ny, 0})
+		}
+	}
+}
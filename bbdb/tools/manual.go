@@ -0,0 +1,245 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+// Manual page scans live in manual/ in an import, numbered in reading order (manual/001.tif...)
+const ManualDir = "manual"
+
+// ManualPageSizes are the WebP sizes every page gets, by longest edge
+var ManualPageSizes = []struct {
+	Name string
+	Size int
+}{
+	{"thumb", 300},
+	{"medium", 1200},
+	{"full", 2400},
+}
+
+const (
+	ManualHeight    = 8.5   // Booklet height when the import doesn't say, width follows the scans
+	ManualLeafDepth = 0.004 // Rough thickness of a page for the booklet model
+)
+
+type ManualPage struct {
+	Number int               `json:"number"`
+	Width  int               `json:"w"` // Size of the full image
+	Height int               `json:"h"`
+	Images map[string]string `json:"images"` // Size name -> url
+}
+
+// ManualManifest is what the paged viewer loads, saved next to the pages as manifest.json
+type ManualManifest struct {
+	Pages      []ManualPage `json:"pages"`
+	PDF        string       `json:"pdf,omitempty"`
+	Searchable bool         `json:"searchable"` // OCR'd text layer in the PDF
+	Model      string       `json:"model,omitempty"`
+}
+
+// ManualOptions are the optional extras for BuildManual, anything left empty is skipped
+type ManualOptions struct {
+	Title     string
+	PDF       bool
+	ModelPath string // Where to write the booklet glb
+	ModelURL  string
+	Height    float32
+
+	Calibration *ColorCalibration // From the package's calibration scan, if it had one
+}
+
+// ManualPageNumber returns the page number of a manual page scan like manual/012.tif
+func ManualPageNumber(path string) (int, bool) {
+	n, err := strconv.Atoi(textureStem(path))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// BuildManual turns a manual's page scans into WebP pages at every size in ManualPageSizes,
+// plus an optional PDF and booklet glb, and writes manifest.json into outputDir.
+// urlPrefix is where outputDir gets served from.
+func BuildManual(pagePaths []string, outputDir, urlPrefix string, opts ManualOptions) (*ManualManifest, error) {
+	if len(pagePaths) == 0 {
+		return nil, fmt.Errorf("manual has no pages")
+	}
+
+	pagePaths = sortedByPage(pagePaths)
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	manifest := &ManualManifest{}
+	var fullPaths, mediumPaths []string
+	for i, src := range pagePaths {
+		page := ManualPage{Number: i + 1, Images: make(map[string]string)}
+		for _, size := range ManualPageSizes {
+			name := fmt.Sprintf("%03d-%s.webp", page.Number, size.Name)
+			dst := filepath.Join(outputDir, name)
+			if err := processImageWithVips(src, dst, size.Size, size.Size, true, opts.Calibration); err != nil {
+				return nil, fmt.Errorf("failed to process page %d: %w", page.Number, err)
+			}
+			page.Images[size.Name] = urlPrefix + "/" + name
+
+			switch size.Name {
+			case "full":
+				fullPaths = append(fullPaths, dst)
+				if w, h, err := imageSize(dst); err == nil {
+					page.Width, page.Height = w, h
+				}
+			case "medium":
+				mediumPaths = append(mediumPaths, dst)
+			}
+		}
+		manifest.Pages = append(manifest.Pages, page)
+	}
+
+	if opts.PDF {
+		pdfPath := filepath.Join(outputDir, "manual.pdf")
+		searchable, err := buildManualPDF(pagePaths, fullPaths, pdfPath)
+		if err != nil {
+			fmt.Printf("Warning: Could not build manual PDF: %v\n", err)
+		} else {
+			manifest.PDF = urlPrefix + "/manual.pdf"
+			manifest.Searchable = searchable
+		}
+	}
+
+	if opts.ModelPath != "" {
+		if err := buildManualModel(mediumPaths, manifest.Pages[0], opts); err != nil {
+			fmt.Printf("Warning: Could not build manual glb: %v\n", err)
+		} else {
+			manifest.Model = opts.ModelURL
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "manifest.json"), data, 0644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// buildManualPDF packs the pages into one PDF. If tesseract is around every page gets OCR'd
+// so the PDF is searchable, otherwise it's just the images.
+func buildManualPDF(srcPaths, fullPaths []string, pdfPath string) (searchable bool, err error) {
+	api.DisableConfigDir()
+	os.Remove(pdfPath) // pdfcpu appends to an existing file
+
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return false, api.ImportImagesFile(fullPaths, pdfPath, nil, nil)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manual-ocr-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var pagePDFs []string
+	for i, src := range srcPaths {
+		base := filepath.Join(tmpDir, fmt.Sprintf("%03d", i+1))
+		cmd := exec.Command("tesseract", src, base, "pdf")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return false, fmt.Errorf("tesseract failed on page %d: %w\n%s", i+1, err, output)
+		}
+		pagePDFs = append(pagePDFs, base+".pdf")
+	}
+	return true, api.MergeCreateFile(pagePDFs, pdfPath, nil)
+}
+
+// buildManualModel makes the booklet glb, the first page is the cover and the last is the back
+func buildManualModel(pagePaths []string, first ManualPage, opts ManualOptions) error {
+	height := opts.Height
+	if height == 0 {
+		height = ManualHeight
+	}
+	width := height
+	if first.Height > 0 {
+		width = height * float32(first.Width) / float32(first.Height)
+	}
+
+	faces := map[string]string{"front": pagePaths[0]}
+	if len(pagePaths) > 1 {
+		faces["back"] = pagePaths[len(pagePaths)-1]
+	}
+	for i := 1; i < len(pagePaths)-1; i++ {
+		faces[fmt.Sprintf("page_%d", i)] = pagePaths[i]
+	}
+
+	item := &ImportItemData{
+		Kind:   models.ItemManual,
+		Name:   opts.Title,
+		Width:  width,
+		Height: height,
+		Depth:  float32(max(1, (len(pagePaths)+1)/2)) * ManualLeafDepth * 2,
+	}
+
+	tmpDir, err := os.MkdirTemp("", "manual-glb-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	glb := filepath.Join(tmpDir, "manual.glb")
+	if err := generateItemGLB(item, faces, glb); err != nil {
+		return err
+	}
+	_, err = Copy(glb, opts.ModelPath)
+	return err
+}
+
+// sortedByPage sorts page scans by their number rather than their name, so 10 comes after 9
+func sortedByPage(paths []string) []string {
+	sorted := append([]string(nil), paths...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, _ := ManualPageNumber(sorted[i])
+		b, _ := ManualPageNumber(sorted[j])
+		return a < b
+	})
+	return sorted
+}
+
+// imageSize reads just enough of an image to get its size
+func imageSize(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// IsManualPage checks an import file is a page scan in manual/
+func IsManualPage(filename string) bool {
+	if !strings.HasPrefix(filename, ManualDir+"/") || strings.Count(filename, "/") != 1 {
+		return false
+	}
+	ext := filepath.Ext(filename)
+	if ext != ".tif" && ext != ".webp" {
+		return false
+	}
+	_, ok := ManualPageNumber(filename)
+	return ok
+}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	PaletteSize = 5 // Most colors kept per front
+	// Colors covering less of the front than this are left out, specks of logo don't say much
+	PaletteMinShare = 0.05
+
+	paletteSampleSize = 64
+	paletteIterations = 12
+)
+
+// PaletteColor is one dominant color and how much of the front it covers
+type PaletteColor struct {
+	Hex   string
+	Share float64
+}
+
+// Palette finds the dominant colors of an image with k-means over a small copy of it, biggest
+// share first. Seeded the same every time so a rebuild doesn't shuffle the colors around.
+func Palette(img image.Image) []PaletteColor {
+	small := imaging.Resize(img, paletteSampleSize, paletteSampleSize, imaging.Box)
+	pixels := make([][3]float64, 0, paletteSampleSize*paletteSampleSize)
+	for i := 0; i < len(small.Pix); i += 4 {
+		if small.Pix[i+3] < 128 {
+			continue // Cutouts on shaped boxes
+		}
+		pixels = append(pixels, [3]float64{float64(small.Pix[i]), float64(small.Pix[i+1]), float64(small.Pix[i+2])})
+	}
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	k := min(PaletteSize, len(pixels))
+	centers := seedCenters(pixels, k)
+	assign := make([]int, len(pixels))
+	for iter := 0; iter < paletteIterations; iter++ {
+		for i, p := range pixels {
+			assign[i] = nearestCenter(p, centers)
+		}
+		sums := make([][3]float64, k)
+		counts := make([]int, k)
+		for i, p := range pixels {
+			c := assign[i]
+			for ch := 0; ch < 3; ch++ {
+				sums[c][ch] += p[ch]
+			}
+			counts[c]++
+		}
+		for c := range centers {
+			if counts[c] == 0 {
+				continue
+			}
+			for ch := 0; ch < 3; ch++ {
+				centers[c][ch] = sums[c][ch] / float64(counts[c])
+			}
+		}
+	}
+
+	counts := make([]int, k)
+	for _, c := range assign {
+		counts[c]++
+	}
+	var palette []PaletteColor
+	for c, center := range centers {
+		share := float64(counts[c]) / float64(len(pixels))
+		if share < PaletteMinShare {
+			continue
+		}
+		palette = append(palette, PaletteColor{
+			Hex:   fmt.Sprintf("#%02x%02x%02x", uint8(math.Round(center[0])), uint8(math.Round(center[1])), uint8(math.Round(center[2]))),
+			Share: math.Round(share*100) / 100,
+		})
+	}
+	sort.SliceStable(palette, func(a, b int) bool { return palette[a].Share > palette[b].Share })
+	return palette
+}
+
+// PaletteFile is Palette for a front on disk
+func PaletteFile(path string) ([]PaletteColor, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return Palette(img), nil
+}
+
+// seedCenters is k-means++, each new center picked further from the ones already there
+func seedCenters(pixels [][3]float64, k int) [][3]float64 {
+	r := rand.New(rand.NewSource(1))
+	centers := [][3]float64{pixels[r.Intn(len(pixels))]}
+	dists := make([]float64, len(pixels))
+	for len(centers) < k {
+		var total float64
+		for i, p := range pixels {
+			dists[i] = colorDist(p, centers[nearestCenter(p, centers)])
+			total += dists[i]
+		}
+		if total == 0 {
+			break // Fewer distinct colors than k
+		}
+		target := r.Float64() * total
+		for i, d := range dists {
+			target -= d
+			if target <= 0 {
+				centers = append(centers, pixels[i])
+				break
+			}
+		}
+	}
+	return centers
+}
+
+func nearestCenter(p [3]float64, centers [][3]float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for c, center := range centers {
+		if d := colorDist(p, center); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func colorDist(a, b [3]float64) float64 {
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dr*dr + dg*dg + db*db
+}
+
+// ColorFamily buckets a #rrggbb color by its hue, lightness and saturation into the names browsing
+// by color goes by: red, orange, yellow, green, teal, blue, purple, pink, brown, black, grey or white
+func ColorFamily(hex string) string {
+	v, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil {
+		return ""
+	}
+	r, g, b := float64(v>>16&0xff)/255, float64(v>>8&0xff)/255, float64(v&0xff)/255
+
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l := (hi + lo) / 2
+	var s, h float64
+	if hi != lo {
+		d := hi - lo
+		s = d / (1 - math.Abs(2*l-1))
+		switch hi {
+		case r:
+			h = math.Mod((g-b)/d, 6)
+		case g:
+			h = (b-r)/d + 2
+		default:
+			h = (r-g)/d + 4
+		}
+		h *= 60
+		if h < 0 {
+			h += 360
+		}
+	}
+
+	switch {
+	case l < 0.12:
+		return "black"
+	case l > 0.9:
+		return "white"
+	case s < 0.15:
+		if l > 0.75 {
+			return "white"
+		}
+		return "grey"
+	case h >= 15 && h < 50 && l < 0.4:
+		return "brown"
+	case h < 15 || h >= 340:
+		return "red"
+	case h < 45:
+		return "orange"
+	case h < 70:
+		return "yellow"
+	case h < 165:
+		return "green"
+	case h < 195:
+		return "teal"
+	case h < 255:
+		return "blue"
+	case h < 315:
+		return "purple"
+	default:
+		return "pink"
+	}
+}
+
+// PaletteFamilies is every family a palette has a color in, in palette order
+func PaletteFamilies(hexes []string) []string {
+	families := []string{}
+	for _, hex := range hexes {
+		if f := ColorFamily(hex); f != "" && !slices.Contains(families, f) {
+			families = append(families, f)
+		}
+	}
+	return families
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestColorFamily(t *testing.T) {
+	cases := []struct {
+		hex  string
+		want string
+	}{
+		{"#000000", "black"},
+		{"#1a1a1a", "black"},
+		{"#ffffff", "white"},
+		{"#f0ece0", "white"}, // Paper
+		{"#808080", "grey"},
+		{"#5a6068", "grey"},
+		{"#ff0000", "red"},
+		{"#b01030", "red"}, // Wraps past 340
+		{"#ff8000", "orange"},
+		{"#6b3a1a", "brown"},
+		{"#ffe000", "yellow"},
+		{"#20c020", "green"},
+		{"#00b0b0", "teal"},
+		{"#1040e0", "blue"},
+		{"#8020c0", "purple"},
+		{"#c000c0", "purple"},
+		{"#ff60b0", "pink"},
+		{"ff0000", "red"}, // No #
+		{"#zzzzzz", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := ColorFamily(c.hex); got != c.want {
+			t.Errorf("ColorFamily(%q) = %q, want %q", c.hex, got, c.want)
+		}
+	}
+}
+
+func TestPaletteFamilies(t *testing.T) {
+	cases := []struct {
+		hexes []string
+		want  []string
+	}{
+		{nil, []string{}},
+		{[]string{"#ff0000", "#b01030", "#1040e0"}, []string{"red", "blue"}},
+		{[]string{"#000000", "#nope", "#ffffff"}, []string{"black", "white"}},
+	}
+	for _, c := range cases {
+		if got := PaletteFamilies(c.hexes); !slices.Equal(got, c.want) {
+			t.Errorf("PaletteFamilies(%v) = %v, want %v", c.hexes, got, c.want)
+		}
+	}
+}
+
+func TestPalette(t *testing.T) {
+	red, blue, white := color.NRGBA{220, 20, 30, 255}, color.NRGBA{20, 40, 200, 255}, color.NRGBA{250, 250, 250, 255}
+
+	// 3/4 red, 1/4 blue with a white speck too small to count
+	img := imaging.New(200, 200, red)
+	img = imaging.Paste(img, imaging.New(200, 50, blue), image.Pt(0, 150))
+	img = imaging.Paste(img, imaging.New(10, 10, white), image.Pt(10, 10))
+
+	palette := Palette(img)
+	var hexes []string
+	for _, c := range palette {
+		hexes = append(hexes, c.Hex)
+	}
+	if want := []string{"#dc141e", "#1428c8"}; !slices.Equal(hexes, want) {
+		t.Fatalf("palette %v, want %v", palette, want)
+	}
+	if palette[0].Share < 0.7 || palette[1].Share < 0.2 {
+		t.Errorf("shares %v", palette)
+	}
+
+	// Seeded, so the same every time
+	again := Palette(img)
+	if !slices.Equal(palette, again) {
+		t.Errorf("second run gave %v, first %v", again, palette)
+	}
+
+	// See-through pixels don't count
+	cutout := imaging.Paste(imaging.New(100, 100, color.NRGBA{}), imaging.New(50, 50, blue), image.Pt(0, 0))
+	if p := Palette(cutout); len(p) != 1 || p[0].Hex != "#1428c8" || p[0].Share != 1 {
+		t.Errorf("cutout palette %v, want just blue", p)
+	}
+	if p := Palette(imaging.New(10, 10, color.NRGBA{})); p != nil {
+		t.Errorf("fully transparent palette %v, want nil", p)
+	}
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Two scans of the same box come out this many bits (of 64) apart or less. Different printings of
+// the same cover can get close too, which is what allow_duplicate is for.
+const DuplicateHashDistance = 10
+
+const phashSize = 32 // DCT input, the hash is the low 8x8 frequencies of it
+
+// HashScan is the perceptual hash of a face scan. With deskew it's found against the background
+// first, the same way DeskewScans would, so a scan with bed around it still matches a cropped one.
+func HashScan(path string, deskew bool) (uint64, error) {
+	img, err := imaging.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	if deskew {
+		if face, ok := cropToFace(img); ok {
+			img = face
+		}
+	}
+	return PerceptualHash(img), nil
+}
+
+// cropToFace finds the face against whatever's around it and straightens it out, at the size
+// deskew detection works at since everything using this only looks at it tiny
+func cropToFace(img image.Image) (image.Image, bool) {
+	quad, ok := detectFace(img)
+	if !ok || quadFillsImage(quad, img.Bounds().Size()) {
+		return nil, false
+	}
+	small := imaging.Fit(img, deskewDetectSize, deskewDetectSize, imaging.Box)
+	sx := float64(small.Bounds().Dx()) / float64(img.Bounds().Dx())
+	sy := float64(small.Bounds().Dy()) / float64(img.Bounds().Dy())
+	for i := range quad {
+		quad[i][0] *= sx
+		quad[i][1] *= sy
+	}
+	w, h := quadSize(quad)
+	if w < phashSize || h < phashSize {
+		return nil, false
+	}
+	return warpQuad(small, quad, w, h), true
+}
+
+// PerceptualHash is the classic pHash: greyscale, shrink to 32x32, DCT, then one bit per low
+// frequency for whether it's above the median. Survives resizing, compression and color shifts.
+func PerceptualHash(img image.Image) uint64 {
+	small := imaging.Resize(imaging.Grayscale(img), phashSize, phashSize, imaging.Lanczos)
+
+	var pixels [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		for x := 0; x < phashSize; x++ {
+			pixels[y][x] = float64(small.Pix[small.PixOffset(x, y)])
+		}
+	}
+
+	// Separable 2D DCT-II, only the 8x8 corner is needed
+	var cos [8][phashSize]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < phashSize; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	var rows [phashSize][8]float64
+	for y := 0; y < phashSize; y++ {
+		for u := 0; u < 8; u++ {
+			for x := 0; x < phashSize; x++ {
+				rows[y][u] += pixels[y][x] * cos[u][x]
+			}
+		}
+	}
+	var coeffs []float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < phashSize; y++ {
+				sum += rows[y][u] * cos[v][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	// The DC term is just overall brightness, leave it out of the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// HashDistance is how many bits two hashes differ by
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// testCover draws something cover-ish: a gradient with a few blocks and discs on it, different per seed
+func testCover(seed int64, w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	top := color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			f := float64(y) / float64(h)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(float64(top.R) * (1 - f)), uint8(float64(top.G) * (1 - f)), uint8(float64(top.B)*(1-f) + 255*f*0.5), 255})
+		}
+	}
+
+	for i := 0; i < 6; i++ {
+		c := color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+		x0, y0 := rng.Intn(w*3/4), rng.Intn(h*3/4)
+		bw, bh := w/8+rng.Intn(w/3), h/8+rng.Intn(h/3)
+		disc := rng.Intn(2) == 0
+		for y := y0; y < min(y0+bh, h); y++ {
+			for x := x0; x < min(x0+bw, w); x++ {
+				dx, dy := float64(x-x0-bw/2)/float64(bw/2), float64(y-y0-bh/2)/float64(bh/2)
+				if !disc || dx*dx+dy*dy <= 1 {
+					img.SetNRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func reencodeJPEG(t *testing.T, img image.Image, quality int) image.Image {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPerceptualHashDistance(t *testing.T) {
+	original := testCover(1, 600, 740)
+	hash := PerceptualHash(original)
+
+	cases := []struct {
+		name string
+		img  func(t *testing.T) image.Image
+		same bool
+	}{
+		{"identical", func(t *testing.T) image.Image { return original }, true},
+		{"half size", func(t *testing.T) image.Image { return imaging.Resize(original, 300, 370, imaging.Lanczos) }, true},
+		{"thumbnail", func(t *testing.T) image.Image { return imaging.Resize(original, 120, 0, imaging.Box) }, true},
+		{"jpeg q90", func(t *testing.T) image.Image { return reencodeJPEG(t, original, 90) }, true},
+		{"jpeg q40", func(t *testing.T) image.Image { return reencodeJPEG(t, original, 40) }, true},
+		{"resized and re-encoded", func(t *testing.T) image.Image {
+			return reencodeJPEG(t, imaging.Resize(original, 450, 555, imaging.Linear), 70)
+		}, true},
+		{"brighter", func(t *testing.T) image.Image { return imaging.AdjustBrightness(original, 10) }, true},
+		{"slightly blurred", func(t *testing.T) image.Image { return imaging.Blur(original, 1.5) }, true},
+		{"different art", func(t *testing.T) image.Image { return testCover(2, 600, 740) }, false},
+		{"other different art", func(t *testing.T) image.Image { return testCover(3, 600, 740) }, false},
+		{"upside down", func(t *testing.T) image.Image { return imaging.Rotate180(original) }, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := HashDistance(hash, PerceptualHash(c.img(t)))
+			if c.same && d > DuplicateHashDistance {
+				t.Errorf("distance %d, want at most %d for the same cover", d, DuplicateHashDistance)
+			}
+			if !c.same && d <= DuplicateHashDistance {
+				t.Errorf("distance %d, want more than %d for a different cover", d, DuplicateHashDistance)
+			}
+		})
+	}
+}
+
+// A scan with the bed still around it should hash like the cropped one once deskew finds the face
+func TestHashScanDeskew(t *testing.T) {
+	dir := t.TempDir()
+	cover := testCover(1, 600, 740)
+	cropped := filepath.Join(dir, "cropped.png")
+	if err := imaging.Save(cover, cropped); err != nil {
+		t.Fatal(err)
+	}
+
+	white := color.NRGBA{255, 255, 255, 255}
+	bed := imaging.Paste(imaging.New(900, 1100, white), imaging.Rotate(cover, 2, white), image.Pt(120, 150))
+	onBed := filepath.Join(dir, "bed.png")
+	if err := imaging.Save(bed, onBed); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := HashScan(cropped, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, deskew := range []bool{true, false} {
+		got, err := HashScan(onBed, deskew)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := HashDistance(want, got)
+		if deskew && d > DuplicateHashDistance {
+			t.Errorf("deskewed distance %d, want at most %d", d, DuplicateHashDistance)
+		}
+		if !deskew && d <= DuplicateHashDistance {
+			t.Errorf("distance without deskew is only %d, the bed should throw it off", d)
+		}
+	}
+}
+
+func TestHashDistance(t *testing.T) {
+	cases := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^uint64(0), 64},
+		{0xdeadbeef, 0xdeadbeef, 0},
+	}
+	for _, c := range cases {
+		if got := HashDistance(c.a, c.b); got != c.want {
+			t.Errorf("HashDistance(%#x, %#x) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package tools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	HeroFile      = "hero.webp"      // 3/4 shot for listings and social cards
+	TurntableFile = "turntable.webp" // Animated spin, only with BBDB_TURNTABLE set
+
+	HeroSize             = 1200
+	HeroYaw              = 30 // Degrees the camera swings round to the right
+	HeroPitch            = 25 // Degrees the camera looks down from
+	TurntableSize        = 480
+	TurntableFrames      = 36
+	TurntableFrameMillis = 80
+	TurntablePitch       = 15
+
+	RenderFOV         = 30   // Vertical field of view in degrees
+	RenderMargin      = 0.06 // Of the image, on every side
+	RenderSupersample = 2    // Rendered this much bigger then scaled down, cheap antialiasing
+)
+
+var RenderBackground = color.NRGBA{R: 238, G: 238, B: 236, A: 255}
+
+// Light comes from up and to the left of the camera, the rest is ambient so dark sides stay readable
+var renderLight = normalize3([3]float32{-0.45, 0.6, 0.65})
+
+const (
+	renderAmbient = 0.55
+	renderDiffuse = 0.5
+)
+
+// renderView is where the camera sits, orbiting the box
+type renderView struct {
+	Yaw, Pitch float64
+}
+
+// renderFit maps projected points onto the image so the box fills it
+type renderFit struct {
+	Scale, OffsetX, OffsetY float64
+}
+
+type renderer struct {
+	parts         []*MeshPart
+	atlas         *image.NRGBA
+	width, height int
+	center        [3]float32
+	distance      float64
+}
+
+type screenVertex struct {
+	X, Y, InvZ float64
+	UV         [2]float32
+	Light      float32
+}
+
+func newRenderer(parts []*MeshPart, atlas image.Image, width, height int) *renderer {
+	r := &renderer{parts: parts, width: width, height: height}
+	if atlas != nil {
+		r.atlas = imaging.Clone(atlas)
+	}
+
+	lo := [3]float32{float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(1))}
+	hi := [3]float32{float32(math.Inf(-1)), float32(math.Inf(-1)), float32(math.Inf(-1))}
+	for _, part := range parts {
+		for _, p := range part.Positions {
+			for i := range p {
+				lo[i] = min(lo[i], p[i])
+				hi[i] = max32(hi[i], p[i])
+			}
+		}
+	}
+	r.center = scale3(add3(lo, hi), 0.5)
+
+	// Far enough back that the whole box is in front of the camera from any angle
+	radius := float64(length3(sub3(hi, lo))) / 2
+	r.distance = radius / math.Sin(RenderFOV*math.Pi/360) * 1.1
+	return r
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// toView moves a point into camera space, the camera looks down -z
+func (r *renderer) toView(p [3]float32, v renderView) [3]float64 {
+	x, y, z := float64(p[0]-r.center[0]), float64(p[1]-r.center[1]), float64(p[2]-r.center[2])
+	x, y, z = rotateForView(x, y, z, v)
+	return [3]float64{x, y, z - r.distance}
+}
+
+// rotateForView turns the box instead of moving the camera, yaw first then pitch
+func rotateForView(x, y, z float64, v renderView) (float64, float64, float64) {
+	yaw, pitch := -v.Yaw*math.Pi/180, v.Pitch*math.Pi/180
+	x, z = x*math.Cos(yaw)+z*math.Sin(yaw), -x*math.Sin(yaw)+z*math.Cos(yaw)
+	y, z = y*math.Cos(pitch)-z*math.Sin(pitch), y*math.Sin(pitch)+z*math.Cos(pitch)
+	return x, y, z
+}
+
+// fit works out one scale and offset that keeps the box inside the image for every view,
+// so turntable frames don't zoom in and out as it spins
+func (r *renderer) fit(views []renderView) renderFit {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, v := range views {
+		for _, part := range r.parts {
+			for _, p := range part.Positions {
+				vp := r.toView(p, v)
+				x, y := vp[0]/-vp[2], vp[1]/-vp[2]
+				minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+				minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+			}
+		}
+	}
+
+	usableW := float64(r.width) * (1 - 2*RenderMargin)
+	usableH := float64(r.height) * (1 - 2*RenderMargin)
+	s := math.Min(usableW/math.Max(maxX-minX, 1e-6), usableH/math.Max(maxY-minY, 1e-6))
+	return renderFit{
+		Scale:   s,
+		OffsetX: float64(r.width)/2 - s*(minX+maxX)/2,
+		OffsetY: float64(r.height)/2 + s*(minY+maxY)/2,
+	}
+}
+
+// render draws the box from one view. Opaque parts go first, see-through ones are blended
+// over them afterwards without writing depth.
+func (r *renderer) render(v renderView, f renderFit) *image.NRGBA {
+	img := imaging.New(r.width, r.height, RenderBackground)
+	depth := make([]float64, r.width*r.height)
+
+	var blended []*MeshPart
+	for _, part := range r.parts {
+		if r.materialFor(part).Blend {
+			blended = append(blended, part)
+			continue
+		}
+		r.drawPart(img, depth, part, v, f, false)
+	}
+	for _, part := range blended {
+		r.drawPart(img, depth, part, v, f, true)
+	}
+	return img
+}
+
+func (r *renderer) materialFor(part *MeshPart) materialDef {
+	if def, ok := partMaterials[part.Material]; ok {
+		return def
+	}
+	return partMaterials[MaterialAtlas]
+}
+
+func (r *renderer) drawPart(img *image.NRGBA, depth []float64, part *MeshPart, v renderView, f renderFit, blend bool) {
+	mat := r.materialFor(part)
+
+	verts := make([]screenVertex, len(part.Positions))
+	for i, p := range part.Positions {
+		vp := r.toView(p, v)
+		invZ := 1 / -vp[2]
+		sv := screenVertex{
+			X:    f.OffsetX + f.Scale*vp[0]*invZ,
+			Y:    f.OffsetY - f.Scale*vp[1]*invZ,
+			InvZ: invZ,
+		}
+		if i < len(part.UVs) {
+			sv.UV = part.UVs[i]
+		}
+
+		// Two sided, a normal facing away from the camera gets flipped round
+		light := float32(1)
+		if i < len(part.Normals) {
+			n := part.Normals[i]
+			nx, ny, nz := rotateForView(float64(n[0]), float64(n[1]), float64(n[2]), v)
+			toCam := normalize3([3]float32{float32(-vp[0]), float32(-vp[1]), float32(-vp[2])})
+			if float64(toCam[0])*nx+float64(toCam[1])*ny+float64(toCam[2])*nz < 0 {
+				nx, ny, nz = -nx, -ny, -nz
+			}
+			d := float32(nx)*renderLight[0] + float32(ny)*renderLight[1] + float32(nz)*renderLight[2]
+			light = renderAmbient + renderDiffuse*max32(d, 0)
+		}
+		sv.Light = light
+		verts[i] = sv
+	}
+
+	for i := 0; i+2 < len(part.Indices); i += 3 {
+		r.drawTriangle(img, depth, verts[part.Indices[i]], verts[part.Indices[i+1]], verts[part.Indices[i+2]], mat, blend)
+	}
+}
+
+func (r *renderer) drawTriangle(img *image.NRGBA, depth []float64, a, b, c screenVertex, mat materialDef, blend bool) {
+	area := (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+	if math.Abs(area) < 1e-9 {
+		return
+	}
+
+	minX := max(0, int(math.Floor(math.Min(a.X, math.Min(b.X, c.X)))))
+	maxX := min(r.width-1, int(math.Ceil(math.Max(a.X, math.Max(b.X, c.X)))))
+	minY := max(0, int(math.Floor(math.Min(a.Y, math.Min(b.Y, c.Y)))))
+	maxY := min(r.height-1, int(math.Ceil(math.Max(a.Y, math.Max(b.Y, c.Y)))))
+
+	for y := minY; y <= maxY; y++ {
+		py := float64(y) + 0.5
+		for x := minX; x <= maxX; x++ {
+			px := float64(x) + 0.5
+
+			w0 := ((b.X-px)*(c.Y-py) - (b.Y-py)*(c.X-px)) / area
+			w1 := ((c.X-px)*(a.Y-py) - (c.Y-py)*(a.X-px)) / area
+			w2 := 1 - w0 - w1
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+
+			invZ := w0*a.InvZ + w1*b.InvZ + w2*c.InvZ
+			idx := y*r.width + x
+			if invZ <= depth[idx] {
+				continue
+			}
+
+			// Perspective correct, interpolate over 1/z then divide it back out
+			pw0, pw1, pw2 := w0*a.InvZ/invZ, w1*b.InvZ/invZ, w2*c.InvZ/invZ
+			light := float64(a.Light)*pw0 + float64(b.Light)*pw1 + float64(c.Light)*pw2
+
+			col := [4]float64{mat.Color[0], mat.Color[1], mat.Color[2], mat.Color[3]}
+			if mat.Textured && r.atlas != nil {
+				u := float64(a.UV[0])*pw0 + float64(b.UV[0])*pw1 + float64(c.UV[0])*pw2
+				v := float64(a.UV[1])*pw0 + float64(b.UV[1])*pw1 + float64(c.UV[1])*pw2
+				t := r.sample(u, v)
+				for i := range col {
+					col[i] *= t[i]
+				}
+			}
+
+			alpha := 1.0
+			if blend {
+				alpha = col[3]
+			} else {
+				depth[idx] = invZ
+			}
+			if alpha <= 0 {
+				continue
+			}
+
+			o := idx * 4
+			for i := 0; i < 3; i++ {
+				lit := math.Min(col[i]*light, 1) * 255
+				img.Pix[o+i] = uint8(float64(img.Pix[o+i])*(1-alpha) + lit*alpha + 0.5)
+			}
+		}
+	}
+}
+
+// sample reads the atlas bilinearly, colors come back 0..1
+func (r *renderer) sample(u, v float64) [4]float64 {
+	b := r.atlas.Bounds()
+	x := u*float64(b.Dx()) - 0.5
+	y := v*float64(b.Dy()) - 0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	texel := func(tx, ty int) [4]float64 {
+		tx = min(max(tx, 0), b.Dx()-1)
+		ty = min(max(ty, 0), b.Dy()-1)
+		o := ty*r.atlas.Stride + tx*4
+		p := r.atlas.Pix[o : o+4]
+		return [4]float64{float64(p[0]) / 255, float64(p[1]) / 255, float64(p[2]) / 255, float64(p[3]) / 255}
+	}
+
+	t00, t10, t01, t11 := texel(x0, y0), texel(x0+1, y0), texel(x0, y0+1), texel(x0+1, y0+1)
+	var out [4]float64
+	for i := range out {
+		top := t00[i]*(1-fx) + t10[i]*fx
+		bottom := t01[i]*(1-fx) + t11[i]*fx
+		out[i] = top*(1-fy) + bottom*fy
+	}
+	return out
+}
+
+// renderImage renders at RenderSupersample times the size and scales it down
+func renderImage(parts []*MeshPart, atlas image.Image, size int, views []renderView) []image.Image {
+	r := newRenderer(parts, atlas, size*RenderSupersample, size*RenderSupersample)
+	f := r.fit(views)
+
+	frames := make([]image.Image, len(views))
+	for i, v := range views {
+		frames[i] = imaging.Resize(r.render(v, f), size, size, imaging.Lanczos)
+	}
+	return frames
+}
+
+// renderPreviews writes the 3/4 hero shot, and the turntable if BBDB_TURNTABLE is set
+func renderPreviews(parts []*MeshPart, atlas image.Image, outputDir string) error {
+	hero := renderImage(parts, atlas, HeroSize, []renderView{{Yaw: HeroYaw, Pitch: HeroPitch}})[0]
+	if err := saveAsWebP(hero, filepath.Join(outputDir, HeroFile)); err != nil {
+		return fmt.Errorf("failed to save hero shot: %w", err)
+	}
+
+	if os.Getenv("BBDB_TURNTABLE") == "" {
+		return nil
+	}
+	return renderTurntable(parts, atlas, filepath.Join(outputDir, TurntableFile))
+}
+
+// renderTurntable spins the box once round, img2webp (from libwebp) stitches the frames together
+func renderTurntable(parts []*MeshPart, atlas image.Image, outputPath string) error {
+	if _, err := exec.LookPath("img2webp"); err != nil {
+		return fmt.Errorf("img2webp not found, skipping the turntable")
+	}
+
+	views := make([]renderView, TurntableFrames)
+	for i := range views {
+		views[i] = renderView{Yaw: HeroYaw + float64(i)*360/TurntableFrames, Pitch: TurntablePitch}
+	}
+	frames := renderImage(parts, atlas, TurntableSize, views)
+
+	tmpDir, err := os.MkdirTemp("", "turntable-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{"-loop", "0", "-lossy", "-q", fmt.Sprintf("%d", WebPQualiity), "-d", fmt.Sprintf("%d", TurntableFrameMillis)}
+	for i, frame := range frames {
+		framePath := filepath.Join(tmpDir, fmt.Sprintf("%03d.png", i))
+		if err := imaging.Save(frame, framePath); err != nil {
+			return err
+		}
+		args = append(args, framePath)
+	}
+	args = append(args, "-o", outputPath)
+
+	if output, err := exec.Command("img2webp", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("img2webp failed: %w\n%s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package tools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Surface maps an import can carry next to a face scan, e.g. front_normal.tif
+const (
+	SurfaceRoughness = "roughness" // Greyscale, white is matte paper and black is a mirror
+	SurfaceNormal    = "normal"    // Tangent space, +Y up like glTF wants
+	SurfaceHeight    = "height"    // Greyscale embossing, turned into a normal map if there isn't one
+	SurfaceMask      = "mask"      // Red marks foil, green marks gloss varnish
+
+	HeightNormalStrength = 4.0  // How steep embossing from a height map looks
+	FoilRoughness        = 0.25 // Foil is metal but never a perfect mirror
+	GlossRoughness       = 0.15
+)
+
+var SurfaceMapKinds = []string{SurfaceRoughness, SurfaceNormal, SurfaceHeight, SurfaceMask}
+
+// Flat normal and plain matte paper, for faces without their own maps
+var (
+	flatNormal     = color.NRGBA{R: 128, G: 128, B: 255, A: 255}
+	matteRoughness = color.NRGBA{R: 255, G: 255, B: 0, A: 255} // glTF reads roughness from G, metallic from B
+)
+
+// textureStem is a texture's filename without the extension, "front" for front.webp
+func textureStem(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// splitSurfaceMap checks if a file is a surface map and if so which scan it belongs to
+func splitSurfaceMap(path string) (stem, kind string, ok bool) {
+	name := textureStem(path)
+	for _, k := range SurfaceMapKinds {
+		if strings.HasSuffix(name, "_"+k) {
+			return strings.TrimSuffix(name, "_"+k), k, true
+		}
+	}
+	return "", "", false
+}
+
+// IsSurfaceMap is true for front_normal.tif and the like
+func IsSurfaceMap(path string) bool {
+	_, _, ok := splitSurfaceMap(path)
+	return ok
+}
+
+// loadSurfaceMap opens a surface map scaled to fit its spot in the atlas
+func loadSurfaceMap(path string, size image.Point) *image.NRGBA {
+	img, err := imaging.Open(path)
+	if err != nil {
+		fmt.Printf("Error opening surface map %s: %v\n", path, err)
+		return nil
+	}
+	return imaging.Resize(img, size.X, size.Y, imaging.Lanczos)
+}
+
+// packSurfaceAtlases builds the normal and metallic/roughness atlases, laid out exactly like the
+// color atlas so the same UVs work. keyStems maps each atlas entry to the scan it came from.
+// Either atlas is nil if no face has maps for it.
+func packSurfaceAtlases(atlas *AtlasResult, keyStems map[string]string, surfacePaths map[string]map[string]string) (normal, metallicRoughness image.Image) {
+	var normalAtlas, mrAtlas *image.NRGBA
+
+	for key, stem := range keyStems {
+		maps := surfacePaths[stem]
+		if len(maps) == 0 {
+			continue
+		}
+		pos := atlas.Positions[key]
+		size := atlas.Sizes[key]
+
+		var n *image.NRGBA
+		if p := maps[SurfaceNormal]; p != "" {
+			n = loadSurfaceMap(p, size)
+		} else if p := maps[SurfaceHeight]; p != "" {
+			if h := loadSurfaceMap(p, size); h != nil {
+				n = heightToNormal(h, HeightNormalStrength)
+			}
+		}
+		if n != nil {
+			if normalAtlas == nil {
+				normalAtlas = imaging.New(atlas.Dimensions.X, atlas.Dimensions.Y, flatNormal)
+			}
+			normalAtlas = imaging.Paste(normalAtlas, n, pos)
+		}
+
+		if maps[SurfaceRoughness] != "" || maps[SurfaceMask] != "" {
+			if mr := metallicRoughnessRegion(maps, size); mr != nil {
+				if mrAtlas == nil {
+					mrAtlas = imaging.New(atlas.Dimensions.X, atlas.Dimensions.Y, matteRoughness)
+				}
+				mrAtlas = imaging.Paste(mrAtlas, mr, pos)
+			}
+		}
+	}
+
+	// Keep nil typed atlases from sneaking out as non-nil interfaces
+	if normalAtlas != nil {
+		normal = normalAtlas
+	}
+	if mrAtlas != nil {
+		metallicRoughness = mrAtlas
+	}
+	return normal, metallicRoughness
+}
+
+// metallicRoughnessRegion combines a face's roughness map and foil/gloss mask into glTF's
+// metallic/roughness layout
+func metallicRoughnessRegion(maps map[string]string, size image.Point) *image.NRGBA {
+	var rough, mask *image.NRGBA
+	if p := maps[SurfaceRoughness]; p != "" {
+		rough = loadSurfaceMap(p, size)
+	}
+	if p := maps[SurfaceMask]; p != "" {
+		mask = loadSurfaceMap(p, size)
+	}
+	if rough == nil && mask == nil {
+		return nil
+	}
+
+	out := imaging.New(size.X, size.Y, matteRoughness)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			r := 1.0
+			metal := 0.0
+			if rough != nil {
+				r = luminance(rough.NRGBAAt(x, y))
+			}
+			if mask != nil {
+				m := mask.NRGBAAt(x, y)
+				foil := float64(m.R) / 255
+				gloss := float64(m.G) / 255
+				r = r*(1-gloss) + GlossRoughness*gloss
+				r = r*(1-foil) + FoilRoughness*foil
+				metal = foil
+			}
+			out.SetNRGBA(x, y, color.NRGBA{R: 255, G: uint8(r * 255), B: uint8(metal * 255), A: 255})
+		}
+	}
+	return out
+}
+
+// heightToNormal turns a greyscale height map into a tangent space normal map
+func heightToNormal(height *image.NRGBA, strength float64) *image.NRGBA {
+	b := height.Bounds()
+	w, h := b.Dx(), b.Dy()
+	at := func(x, y int) float64 {
+		x = min(w-1, x)
+		y = min(h-1, y)
+		if x < 0 {
+			x = 0
+		}
+		if y < 0 {
+			y = 0
+		}
+		return luminance(height.NRGBAAt(b.Min.X+x, b.Min.Y+y))
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Image rows go down but normal map +Y goes up
+			nx := -(at(x+1, y) - at(x-1, y)) * strength
+			ny := (at(x, y+1) - at(x, y-1)) * strength
+			l := math.Sqrt(nx*nx + ny*ny + 1)
+			out.SetNRGBA(x, y, color.NRGBA{
+				R: uint8((nx/l + 1) * 127.5),
+				G: uint8((ny/l + 1) * 127.5),
+				B: uint8((1/l + 1) * 127.5),
+				A: 255,
+			})
+		}
+	}
+	return out
+}
+
+func luminance(c color.NRGBA) float64 {
+	return (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+}
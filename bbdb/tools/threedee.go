@@ -3,10 +3,12 @@ package tools
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/disintegration/imaging"
@@ -24,25 +26,80 @@ const (
 	KTX2Quality         = 255
 	KTX2QualityLow      = 180
 	OutputFormat        = "glb"
+
+	BevelRadius        = 0.04 // Rounded box edges, override with BBDB_BEVEL_RADIUS (0 turns them off)
+	BevelSegments      = 4    // Steps per rounded edge, override with BBDB_BEVEL_SEGMENTS
+	MaxBevelSegments   = 32   // Already plenty smooth, a few times this and the box runs out of uint16 indices
+	CardboardThickness = 0.06 // Gatefold flaps are about this thick once they get real edges
 )
 
+// CardboardEdgeColor is what the cut edge of a gatefold flap looks like
+var CardboardEdgeColor = color.NRGBA{R: 196, G: 184, B: 164, A: 255}
+
 // GatefoldMode describes how gatefolds are arranged on a box
 type GatefoldMode int
 
 const (
-	GatefoldNone         GatefoldMode = iota
-	GatefoldSingleFront               // One full-width flap on front
-	GatefoldSingleBack                // One full-width flap on back
-	GatefoldDoubleFront               // Two half-width flaps on front (book/double-door)
-	GatefoldFrontAndBack              // One full-width flap on front AND one on back
+	GatefoldNone             GatefoldMode = iota
+	GatefoldSingleFront                   // One full-width flap on front
+	GatefoldSingleBack                    // One full-width flap on back
+	GatefoldDoubleFront                   // Two half-width flaps on front (book/double-door)
+	GatefoldFrontAndBack                  // One full-width flap on front AND one on back
+	GatefoldTrifoldFront                  // Two stacked flaps on front, the outer one opens one way and the inner one the other
+	GatefoldDoublePanelFront              // Two stacked flaps on front that both open the same way (vinyl double gatefold)
 )
 
+// gatefoldLayouts maps the box_types.gatefold_layout column to a geometry mode
+var gatefoldLayouts = map[string]GatefoldMode{
+	models.GatefoldLayoutNone:         GatefoldNone,
+	models.GatefoldLayoutSingleFront:  GatefoldSingleFront,
+	models.GatefoldLayoutSingleBack:   GatefoldSingleBack,
+	models.GatefoldLayoutDoubleFront:  GatefoldDoubleFront,
+	models.GatefoldLayoutFrontAndBack: GatefoldFrontAndBack,
+	models.GatefoldLayoutTrifold:      GatefoldTrifoldFront,
+	models.GatefoldLayoutDoublePanel:  GatefoldDoublePanelFront,
+}
+
 type GameInfo struct {
 	Title   string  `json:"title"`
 	Width   float32 `json:"width"`
 	Height  float32 `json:"height"`
 	Depth   float32 `json:"depth"`
 	BoxType uint    `json:"box_type"`
+
+	// BoxTypeDef is the box_types row for BoxType, if the caller loaded it.
+	// Falls back to the seed definitions when nil.
+	BoxTypeDef *models.BoxType `json:"-"`
+
+	// Gatefold flaps get an alpha blended material so see-through scans stay see-through
+	GatefoldTransparent bool `json:"gatefold_transparent"`
+}
+
+// MeshDetail is the optional extra geometry on top of the plain box, the low LOD tier leaves it all off
+type MeshDetail struct {
+	BevelRadius   float32 // 0 for sharp edges
+	BevelSegments int
+	Cardboard     bool // Flaps get a real thickness and plain cardboard edges instead of reusing the box sides
+}
+
+// meshDetailFor works out the mesh detail for a quality tier
+func meshDetailFor(lowQuality bool) MeshDetail {
+	if lowQuality {
+		return MeshDetail{}
+	}
+
+	detail := MeshDetail{BevelRadius: BevelRadius, BevelSegments: BevelSegments, Cardboard: true}
+	if v := os.Getenv("BBDB_BEVEL_RADIUS"); v != "" {
+		if r, err := strconv.ParseFloat(v, 32); err == nil {
+			detail.BevelRadius = float32(r)
+		}
+	}
+	if v := os.Getenv("BBDB_BEVEL_SEGMENTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			detail.BevelSegments = min(n, MaxBevelSegments)
+		}
+	}
+	return detail
 }
 
 // AtlasResult holds texture atlas packing results
@@ -62,6 +119,39 @@ type MeshPart struct {
 	Normals   [][3]float32
 	UVs       [][2]float32
 	Indices   []uint16
+
+	// Gatefold flaps only: which edge the flap swings from and a point on that edge
+	Hinge string
+	Pivot [3]float32
+	// Flaps tucked under another flap open after it, 0 opens first
+	OpenStep int
+
+	// Material is one of the Material* names, empty means the opaque atlas
+	Material string
+}
+
+// Materials a MeshPart can ask for, see partMaterials
+const (
+	MaterialAtlas        = "atlas"
+	MaterialAtlasBlend   = "atlas_blend"
+	MaterialClearPlastic = "clear_plastic"
+	MaterialBlackPlastic = "black_plastic"
+)
+
+// materialDef is how a named material ends up in the glTF
+type materialDef struct {
+	Textured    bool // Samples the atlas, otherwise just Color
+	Color       [4]float64
+	Roughness   float64
+	Blend       bool
+	DoubleSided bool
+}
+
+var partMaterials = map[string]materialDef{
+	MaterialAtlas:        {Textured: true, Color: [4]float64{1, 1, 1, 1}, Roughness: 1},
+	MaterialAtlasBlend:   {Textured: true, Color: [4]float64{1, 1, 1, 1}, Roughness: 1, Blend: true, DoubleSided: true},
+	MaterialClearPlastic: {Color: [4]float64{0.92, 0.94, 0.96, 0.15}, Roughness: 0.05, Blend: true, DoubleSided: true},
+	MaterialBlackPlastic: {Color: [4]float64{0.02, 0.02, 0.02, 1}, Roughness: 0.4},
 }
 
 func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string, lowQuality bool) error {
@@ -83,10 +173,10 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 	}
 
 	// Determine box properties
-	boxType := gameInfo.BoxType
+	boxType := resolveBoxType(gameInfo)
 	var topWidth *float32
-	if boxType == models.FindBoxTypeIDByName("Eidos Trapezoid") {
-		var tw float32 = 5.75
+	if boxType.Shape == models.BoxShapeTrapezoid && boxType.TopWidthRatio != nil {
+		tw := gameInfo.Width * *boxType.TopWidthRatio
 		topWidth = &tw
 	}
 
@@ -95,13 +185,31 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 
 	// Sort texture paths — detect all gatefold texture variants
 	boxSortedPaths := make([]string, 6)
-	gatefoldPaths := make(map[string]string) // key: "left", "right", "front_left", "front_right", "back"
+	gatefoldPaths := make(map[string]string) // key: "left", "right", "top", "bottom", "front_left", "front_right", "back", "inner_front"...
 	boxSideNames := []string{"front", "back", "top", "bottom", "right", "left"}
+	surfacePaths := make(map[string]map[string]string) // key: scan stem ("front", "gatefold_left"...), then map kind
 
 	for _, path := range texturePaths {
+		// Surface maps ride along with the scan they're named after, keep them out of the face matching
+		if stem, kind, ok := splitSurfaceMap(path); ok {
+			if surfacePaths[stem] == nil {
+				surfacePaths[stem] = make(map[string]string)
+			}
+			surfacePaths[stem][kind] = path
+			continue
+		}
+
 		filenameLower := strings.ToLower(filepath.Base(path))
 
 		switch {
+		case strings.Contains(filenameLower, "gatefold_inner_front"):
+			gatefoldPaths["inner_front"] = path
+		case strings.Contains(filenameLower, "gatefold_inner_back"):
+			gatefoldPaths["inner_back"] = path
+		case strings.Contains(filenameLower, "gatefold_top"):
+			gatefoldPaths["top"] = path
+		case strings.Contains(filenameLower, "gatefold_bottom"):
+			gatefoldPaths["bottom"] = path
 		case strings.Contains(filenameLower, "gatefold_front_left_back"):
 			gatefoldPaths["front_left_back"] = path
 		case strings.Contains(filenameLower, "gatefold_front_right_back"):
@@ -137,13 +245,24 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 		}
 	}
 
+	// Scans for the front flap's inside and whatever it covers, depends on the hinge
+	flapInnerPath, flapUnderPath := frontFlapPaths(boxType.GatefoldHinge, gatefoldPaths)
+
 	// Determine if we actually have gatefold textures for the requested mode
 	hasGatefold := false
 	switch gatefoldMode {
 	case GatefoldSingleFront:
-		// Need legacy left+right, or front_left+front_right
-		hasGatefold = (gatefoldPaths["left"] != "" && gatefoldPaths["right"] != "") ||
-			(gatefoldPaths["front_left"] != "" && gatefoldPaths["front_right"] != "")
+		// Need legacy left+right, or front_left+front_right (top+bottom for vertical flaps)
+		hasGatefold = flapInnerPath != "" && flapUnderPath != ""
+	case GatefoldTrifoldFront, GatefoldDoublePanelFront:
+		hasGatefold = flapInnerPath != "" && flapUnderPath != "" &&
+			gatefoldPaths["inner_front"] != "" && gatefoldPaths["inner_back"] != ""
+		// Variants scanned before the type got a second panel only have the one flap, keep building that
+		if !hasGatefold && flapInnerPath != "" && flapUnderPath != "" {
+			fmt.Printf("Warning: No gatefold_inner_front/gatefold_inner_back scans, building a single front gatefold\n")
+			gatefoldMode = GatefoldSingleFront
+			hasGatefold = true
+		}
 	case GatefoldSingleBack:
 		hasGatefold = (gatefoldPaths["left"] != "" && gatefoldPaths["right"] != "") ||
 			(gatefoldPaths["back"] != "")
@@ -152,8 +271,7 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 			gatefoldPaths["front_left_back"] != "" && gatefoldPaths["front_right_back"] != ""
 	case GatefoldFrontAndBack:
 		// Need textures for both front and back flaps
-		hasFront := (gatefoldPaths["left"] != "" && gatefoldPaths["right"] != "") ||
-			(gatefoldPaths["front_left"] != "" && gatefoldPaths["front_right"] != "")
+		hasFront := flapInnerPath != "" && flapUnderPath != ""
 		hasBack := gatefoldPaths["back_left"] != "" && gatefoldPaths["back_right"] != ""
 		hasGatefold = hasFront && hasBack
 	}
@@ -162,44 +280,50 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 		gatefoldMode = GatefoldNone
 	}
 
-	// Pack textures into atlas
+	// Pack textures into atlas, remembering which scan each image came from so surface maps can follow it
 	imagesToPack := make(map[string]image.Image)
+	imageSources := make(map[image.Image]string)
+	load := func(path string) image.Image {
+		img := loadAndResizeImage(path, lowQuality)
+		imageSources[img] = path
+		return img
+	}
 
 	for i, path := range boxSortedPaths {
-		img := loadAndResizeImage(path, lowQuality)
+		img := load(path)
 		imagesToPack[boxSideNames[i]] = img
 	}
 
 	if hasGatefold {
 		switch gatefoldMode {
 		case GatefoldSingleFront:
-			// Resolve texture paths — prefer new naming, fall back to legacy
-			rightPath := gatefoldPaths["front_right"]
-			if rightPath == "" {
-				rightPath = gatefoldPaths["right"]
-			}
-			leftPath := gatefoldPaths["front_left"]
-			if leftPath == "" {
-				leftPath = gatefoldPaths["left"]
-			}
-
-			gatefoldRightImg := loadAndResizeImage(rightPath, lowQuality)
-			gatefoldLeftImg := loadAndResizeImage(leftPath, lowQuality)
+			gatefoldUnderImg := load(flapUnderPath)
+			gatefoldInnerImg := load(flapInnerPath)
 
 			// The original front face becomes the inside of the gatefold
 			baseFaceImg := imagesToPack["front"]
 			imagesToPack["gatefold_front_inner"] = baseFaceImg
 
-			// The outer face shows gatefold_right, the back shows gatefold_left
-			imagesToPack["front"] = gatefoldRightImg
-			imagesToPack["gatefold_front_back"] = gatefoldLeftImg
+			// The outer face shows what's under the flap (gatefold_right for a left hinge),
+			// the back shows the flap's inside (gatefold_left for a left hinge)
+			imagesToPack["front"] = gatefoldUnderImg
+			imagesToPack["gatefold_front_back"] = gatefoldInnerImg
+
+		case GatefoldTrifoldFront, GatefoldDoublePanelFront:
+			// Same as a single front flap, with a second panel tucked between it and the box
+			imagesToPack["gatefold_front_inner"] = imagesToPack["front"]
+			imagesToPack["front"] = load(flapUnderPath)
+			imagesToPack["gatefold_front_back"] = load(flapInnerPath)
+
+			imagesToPack["gatefold_inner_front"] = load(gatefoldPaths["inner_front"])
+			imagesToPack["gatefold_inner_back"] = load(gatefoldPaths["inner_back"])
 
 		case GatefoldSingleBack:
 			rightPath := gatefoldPaths["right"]
 			leftPath := gatefoldPaths["left"]
 
-			gatefoldRightImg := loadAndResizeImage(rightPath, lowQuality)
-			gatefoldLeftImg := loadAndResizeImage(leftPath, lowQuality)
+			gatefoldRightImg := load(rightPath)
+			gatefoldLeftImg := load(leftPath)
 
 			// The original back face becomes the inside of the gatefold
 			baseFaceImg := imagesToPack["back"]
@@ -210,10 +334,10 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 			imagesToPack["gatefold_back_back"] = gatefoldRightImg
 
 		case GatefoldDoubleFront:
-			frontLeftImg := loadAndResizeImage(gatefoldPaths["front_left"], lowQuality)
-			frontRightImg := loadAndResizeImage(gatefoldPaths["front_right"], lowQuality)
-			frontLeftBackImg := loadAndResizeImage(gatefoldPaths["front_left_back"], lowQuality)
-			frontRightBackImg := loadAndResizeImage(gatefoldPaths["front_right_back"], lowQuality)
+			frontLeftImg := load(gatefoldPaths["front_left"])
+			frontRightImg := load(gatefoldPaths["front_right"])
+			frontLeftBackImg := load(gatefoldPaths["front_left_back"])
+			frontRightBackImg := load(gatefoldPaths["front_right_back"])
 
 			// The original front face stays as-is — visible when both doors are open
 			// (no need to move it, the box "front" face is the inner middle)
@@ -227,18 +351,8 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 			imagesToPack["gatefold_front_right_back"] = frontRightBackImg
 
 		case GatefoldFrontAndBack:
-			// Front flap — prefer new naming, fall back to legacy
-			frontRightPath := gatefoldPaths["front_right"]
-			if frontRightPath == "" {
-				frontRightPath = gatefoldPaths["right"]
-			}
-			frontLeftPath := gatefoldPaths["front_left"]
-			if frontLeftPath == "" {
-				frontLeftPath = gatefoldPaths["left"]
-			}
-
-			frontRightImg := loadAndResizeImage(frontRightPath, lowQuality)
-			frontLeftImg := loadAndResizeImage(frontLeftPath, lowQuality)
+			frontRightImg := load(flapUnderPath)
+			frontLeftImg := load(flapInnerPath)
 
 			// Original front face → inside of front gatefold
 			frontBaseImg := imagesToPack["front"]
@@ -247,8 +361,8 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 			imagesToPack["gatefold_front_back"] = frontLeftImg
 
 			// Back flap
-			backRightImg := loadAndResizeImage(gatefoldPaths["back_right"], lowQuality)
-			backLeftImg := loadAndResizeImage(gatefoldPaths["back_left"], lowQuality)
+			backRightImg := load(gatefoldPaths["back_right"])
+			backLeftImg := load(gatefoldPaths["back_left"])
 
 			// Original back face → inside of back gatefold
 			backBaseImg := imagesToPack["back"]
@@ -258,6 +372,12 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 		}
 	}
 
+	// Flap edges need a bit of plain cardboard in the atlas
+	detail := meshDetailFor(lowQuality)
+	if detail.Cardboard {
+		imagesToPack["cardboard"] = imaging.New(8, 8, CardboardEdgeColor)
+	}
+
 	// Create atlas filename
 	atlasFile := randomString(24) + fmt.Sprintf("-atlas%s.ktx2", qualitySuffix)
 
@@ -267,15 +387,48 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 	atlasResult := packTextures(imagesToPack)
 
 	// Save atlas as KTX2
-	if !saveAsKTX2(atlasResult.Atlas, atlasFilename, KTX2Compression, ktx2Quality) {
+	if !saveAsKTX2(atlasResult.Atlas, atlasFilename, KTX2Compression, ktx2Quality, false) {
 		return fmt.Errorf("Failed to save KTX2 texture atlas")
 	}
+	textures := atlasTextures{Color: atlasFilename}
+
+	// Surface maps get their own atlases with the same layout, the low tier goes without
+	if !lowQuality && len(surfacePaths) > 0 {
+		keyStems := make(map[string]string)
+		for key, img := range imagesToPack {
+			if src, ok := imageSources[img]; ok {
+				keyStems[key] = textureStem(src)
+			}
+		}
+
+		normalAtlas, mrAtlas := packSurfaceAtlases(atlasResult, keyStems, surfacePaths)
+		if normalAtlas != nil {
+			textures.Normal = strings.TrimSuffix(atlasFilename, ".ktx2") + "-normal.ktx2"
+			if !saveAsKTX2(normalAtlas, textures.Normal, KTX2Compression, ktx2Quality, true) {
+				return fmt.Errorf("Failed to save KTX2 normal atlas")
+			}
+		}
+		if mrAtlas != nil {
+			textures.MetallicRoughness = strings.TrimSuffix(atlasFilename, ".ktx2") + "-mr.ktx2"
+			if !saveAsKTX2(mrAtlas, textures.MetallicRoughness, KTX2Compression, ktx2Quality, true) {
+				return fmt.Errorf("Failed to save KTX2 metallic/roughness atlas")
+			}
+		}
+	}
 
 	// Generate array of distinct MeshParts
-	meshParts := generateGeometry(gameInfo, atlasResult, gatefoldMode, topWidth)
+	meshParts := generateGeometry(gameInfo, atlasResult, gatefoldMode, topWidth, detail)
+
+	// Previews and exports are made off the same geometry, only once and at the better quality
+	if !lowQuality {
+		if err := renderPreviews(meshParts, atlasResult.Atlas, outputDir); err != nil {
+			fmt.Printf("Warning: Could not render previews: %v\n", err)
+		}
+		writeExports(gameInfo, meshParts, atlasResult, gatefoldMode, outputDir)
+	}
 
 	// Generate glTF structured document
-	doc, err := generateGLTFDocument(gameInfo, meshParts, atlasFilename)
+	doc, err := generateGLTFDocument(gameInfo, meshParts, textures)
 	if err != nil {
 		return fmt.Errorf("failed to build gltf document: %w", err)
 	}
@@ -296,29 +449,128 @@ func GenerateGLTFBox(gameInfo *GameInfo, texturePaths []string, outputDir string
 	return nil
 }
 
-// determineGatefoldMode maps box type names to gatefold configurations
-func determineGatefoldMode(boxType uint) GatefoldMode {
-	switch boxType {
-	case models.FindBoxTypeIDByName("Big Box With Back Gatefold"):
-		return GatefoldSingleBack
-	case models.FindBoxTypeIDByName("Big Box With Double Gatefold"):
-		return GatefoldDoubleFront
-	case models.FindBoxTypeIDByName("Big Box With Front And Back Gatefold"):
-		return GatefoldFrontAndBack
+// resolveBoxType returns the box type definition to build from
+func resolveBoxType(gameInfo *GameInfo) *models.BoxType {
+	if gameInfo.BoxTypeDef != nil {
+		return gameInfo.BoxTypeDef
+	}
+	if bt := models.FindBoxType(gameInfo.BoxType); bt != nil {
+		return bt
+	}
+
+	fmt.Printf("Warning: Unknown box type %d, building a plain box\n", gameInfo.BoxType)
+	return &models.BoxType{ID: gameInfo.BoxType, Shape: models.BoxShapeCuboid, GatefoldLayout: models.GatefoldLayoutNone}
+}
+
+// determineGatefoldMode maps a box type's gatefold layout to a gatefold configuration
+// The caller will check if gatefold textures actually exist
+func determineGatefoldMode(boxType *models.BoxType) GatefoldMode {
+	mode, ok := gatefoldLayouts[boxType.GatefoldLayout]
+	if !ok {
+		fmt.Printf("Warning: Unknown gatefold layout '%s' on box type %d\n", boxType.GatefoldLayout, boxType.ID)
+		return GatefoldNone
+	}
+	return mode
+}
+
+// frontFlapPaths picks the scans for a front flap's inside and the face it covers.
+// Both are named after where they end up once the flap is open, so a left hinged flap's
+// inside is gatefold_left and a right hinged one's is gatefold_right.
+func frontFlapPaths(hinge string, gatefoldPaths map[string]string) (innerPath, underPath string) {
+	// Prefer new naming, fall back to legacy
+	leftPath := gatefoldPaths["front_left"]
+	if leftPath == "" {
+		leftPath = gatefoldPaths["left"]
+	}
+	rightPath := gatefoldPaths["front_right"]
+	if rightPath == "" {
+		rightPath = gatefoldPaths["right"]
+	}
+
+	switch hinge {
+	case models.HingeRight:
+		return rightPath, leftPath
+	case models.HingeTop:
+		// Older vertical gatefolds were scanned as left/right
+		if gatefoldPaths["top"] != "" && gatefoldPaths["bottom"] != "" {
+			return gatefoldPaths["top"], gatefoldPaths["bottom"]
+		}
+	}
+	return leftPath, rightPath
+}
+
+// oppositeHinge returns the hinge on the other side of the box, for flaps that open the other way
+func oppositeHinge(hinge string) string {
+	switch hinge {
+	case models.HingeLeft:
+		return models.HingeRight
+	case models.HingeRight:
+		return models.HingeLeft
+	}
+	return hinge
+}
+
+// gatefoldBackOrientation works out how the inner face of a front flap is laid out.
+// Sideways artwork is rotated back, top hinged flaps flip over so the inside reads upside down.
+func gatefoldBackOrientation(boxType *models.BoxType, hinge string, isTrapezoid bool) (flipBack bool, flipVert *bool, rotation int) {
+	switch {
+	case boxType.FaceRotation != 0:
+		return false, nil, -boxType.FaceRotation
+	case hinge == models.HingeTop:
+		f := false
+		return true, &f, 0
 	default:
-		// All other gatefold-capable types use single front
-		// The caller will check if gatefold textures actually exist
-		return GatefoldSingleFront
+		return isTrapezoid, nil, 0
+	}
+}
+
+// atlasTextures are the KTX2 files a box is textured with, the surface maps are optional
+type atlasTextures struct {
+	Color             string
+	Normal            string
+	MetallicRoughness string
+}
+
+// paths lists the atlases in the order they get embedded, so the color atlas is always texture 0
+func (a atlasTextures) paths() []string {
+	paths := []string{a.Color}
+	for _, p := range []string{a.Normal, a.MetallicRoughness} {
+		if p != "" {
+			paths = append(paths, p)
+		}
 	}
+	return paths
+}
+
+// surfaceTextureIndexes works out which texture each surface map will end up as
+type surfaceTextureIndexes struct {
+	Normal            *int
+	MetallicRoughness *int
+}
+
+func (a atlasTextures) indexes() surfaceTextureIndexes {
+	var idx surfaceTextureIndexes
+	next := 1
+	if a.Normal != "" {
+		idx.Normal = gltf.Index(next)
+		next++
+	}
+	if a.MetallicRoughness != "" {
+		idx.MetallicRoughness = gltf.Index(next)
+	}
+	return idx
 }
 
 // generateGLTFDocument dynamically loops through N amount of MeshParts
-func generateGLTFDocument(gameInfo *GameInfo, parts []*MeshPart, texturePath string) (*gltf.Document, error) {
+func generateGLTFDocument(gameInfo *GameInfo, parts []*MeshPart, textures atlasTextures) (*gltf.Document, error) {
 	doc := gltf.NewDocument()
 	doc.Asset.Generator = "BigBoxDB glTF Generator"
 	doc.ExtensionsUsed = append(doc.ExtensionsUsed, "KHR_texture_basisu")
 
 	var sceneNodes []int
+	var hinged []hingedNode
+	materialIndexes := make(map[string]int)
+	surface := textures.indexes()
 
 	// 1. Generate Buffers, BufferViews, Accessors, Meshes, and Nodes for each piece
 	for _, part := range parts {
@@ -343,7 +595,7 @@ func generateGLTFDocument(gameInfo *GameInfo, parts []*MeshPart, texturePath str
 						gltf.NORMAL:     normAccessor,
 						gltf.TEXCOORD_0: uvAccessor,
 					},
-					Material: gltf.Index(0), // Uses the shared atlas material
+					Material: gltf.Index(materialIndex(doc, materialIndexes, gameInfo, surface, part.Material)),
 				},
 			},
 		})
@@ -351,22 +603,66 @@ func generateGLTFDocument(gameInfo *GameInfo, parts []*MeshPart, texturePath str
 		meshIndex := len(doc.Meshes) - 1
 
 		// Create a Node that Three.js can target by name
-		doc.Nodes = append(doc.Nodes, &gltf.Node{
+		node := &gltf.Node{
 			Name: part.Name,
 			Mesh: gltf.Index(meshIndex),
-		})
+		}
+		if part.Hinge != "" {
+			node.Extras = map[string]interface{}{
+				"hinge": part.Hinge,
+				"pivot": part.Pivot,
+			}
+		}
+		doc.Nodes = append(doc.Nodes, node)
 
 		nodeIndex := len(doc.Nodes) - 1
-		sceneNodes = append(sceneNodes, nodeIndex)
+		if part.Hinge == "" {
+			sceneNodes = append(sceneNodes, nodeIndex)
+			continue
+		}
+
+		// Flaps hang off a pivot node sitting on the hinge, the mesh is moved back so it
+		// ends up where it always was and the pivot is what gets rotated open
+		p := part.Pivot
+		node.Translation = [3]float64{-float64(p[0]), -float64(p[1]), -float64(p[2])}
+		doc.Nodes = append(doc.Nodes, &gltf.Node{
+			Name:        part.Name + "Pivot",
+			Children:    []int{nodeIndex},
+			Translation: [3]float64{float64(p[0]), float64(p[1]), float64(p[2])},
+		})
+		pivotIndex := len(doc.Nodes) - 1
+		sceneNodes = append(sceneNodes, pivotIndex)
+		hinged = append(hinged, hingedNode{Node: pivotIndex, Part: part})
 	}
 
 	// gltf.NewDocument() already creates one empty scene at index 0, so update it
 	doc.Scenes[0].Nodes = sceneNodes
+	// The size it's meant to be, so `glb validate` can check the geometry against it
+	if gameInfo.Width > 0 {
+		doc.Scenes[0].Extras = map[string]interface{}{
+			"width":  gameInfo.Width,
+			"height": gameInfo.Height,
+			"depth":  gameInfo.Depth,
+		}
+	}
+
+	addOpenAnimations(doc, hinged)
 
-	// 2. Embed the KTX2 Texture Data
-	textureData, err := os.ReadFile(texturePath)
+	// 2. Embed the KTX2 textures, in the order surfaceTextureIndexes handed them out
+	for _, path := range textures.paths() {
+		if err := embedKTX2(doc, path); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// embedKTX2 adds a KTX2 file to the glb's buffer as the next image and texture
+func embedKTX2(doc *gltf.Document, path string) error {
+	textureData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read texture for embedding: %w", err)
+		return fmt.Errorf("failed to read texture for embedding: %w", err)
 	}
 
 	if len(doc.Buffers) == 0 {
@@ -391,7 +687,6 @@ func generateGLTFDocument(gameInfo *GameInfo, parts []*MeshPart, texturePath str
 	})
 	bvIndex := len(doc.BufferViews) - 1
 
-	// 3. Map the Material tree
 	doc.Images = append(doc.Images, &gltf.Image{
 		MimeType:   "image/ktx2",
 		BufferView: gltf.Index(bvIndex),
@@ -400,21 +695,64 @@ func generateGLTFDocument(gameInfo *GameInfo, parts []*MeshPart, texturePath str
 	doc.Textures = append(doc.Textures, &gltf.Texture{
 		Extensions: gltf.Extensions{
 			"KHR_texture_basisu": map[string]interface{}{
-				"source": 0,
+				"source": len(doc.Images) - 1,
 			},
 		},
 	})
+	return nil
+}
+
+// materialIndex returns the index of a named material, adding it to the document the first time
+// it's used. Textured materials all point at texture 0, the atlas, plus any surface maps we have.
+func materialIndex(doc *gltf.Document, indexes map[string]int, gameInfo *GameInfo, surface surfaceTextureIndexes, name string) int {
+	if name == "" {
+		name = MaterialAtlas
+	}
+	if idx, ok := indexes[name]; ok {
+		return idx
+	}
+
+	def, ok := partMaterials[name]
+	if !ok {
+		fmt.Printf("Warning: Unknown material '%s', using the atlas\n", name)
+		def = partMaterials[MaterialAtlas]
+	}
+
+	// Keep the old name for the plain atlas material, clients look it up
+	matName := slug.Make(gameInfo.Title) + "-material"
+	if name != MaterialAtlas {
+		matName = slug.Make(gameInfo.Title) + "-" + strings.ReplaceAll(name, "_", "-")
+	}
 
-	doc.Materials = append(doc.Materials, &gltf.Material{
-		Name: slug.Make(gameInfo.Title) + "-material",
+	color := def.Color
+	mat := &gltf.Material{
+		Name: matName,
 		PBRMetallicRoughness: &gltf.PBRMetallicRoughness{
-			BaseColorTexture: &gltf.TextureInfo{Index: 0},
-			MetallicFactor:   gltf.Float(0.0),
-			RoughnessFactor:  gltf.Float(1.0),
+			BaseColorFactor: &color,
+			MetallicFactor:  gltf.Float(0.0),
+			RoughnessFactor: gltf.Float(def.Roughness),
 		},
-	})
+		DoubleSided: def.DoubleSided,
+	}
+	if def.Textured {
+		mat.PBRMetallicRoughness.BaseColorTexture = &gltf.TextureInfo{Index: 0}
 
-	return doc, nil
+		if surface.Normal != nil {
+			mat.NormalTexture = &gltf.NormalTexture{Index: surface.Normal}
+		}
+		if surface.MetallicRoughness != nil {
+			// The map decides what's foil, so let it through
+			mat.PBRMetallicRoughness.MetallicRoughnessTexture = &gltf.TextureInfo{Index: *surface.MetallicRoughness}
+			mat.PBRMetallicRoughness.MetallicFactor = gltf.Float(1.0)
+		}
+	}
+	if def.Blend {
+		mat.AlphaMode = gltf.AlphaBlend
+	}
+
+	doc.Materials = append(doc.Materials, mat)
+	indexes[name] = len(doc.Materials) - 1
+	return indexes[name]
 }
 
 func createBlackPlaceholder(outputDir string, sideName string, gameInfo *GameInfo, upsizeRatio int, qualitySuffix string) string {
@@ -459,7 +797,7 @@ func loadAndResizeImage(path string, lowQuality bool) image.Image {
 }
 
 func packTextures(images map[string]image.Image) *AtlasResult {
-	// Sort images by height
+	// Sort images by height, then name so the layout comes out the same every time
 	type imageEntry struct {
 		name string
 		img  image.Image
@@ -471,7 +809,11 @@ func packTextures(images map[string]image.Image) *AtlasResult {
 	}
 
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].img.Bounds().Dy() > entries[j].img.Bounds().Dy()
+		hi, hj := entries[i].img.Bounds().Dy(), entries[j].img.Bounds().Dy()
+		if hi != hj {
+			return hi > hj
+		}
+		return entries[i].name < entries[j].name
 	})
 
 	positions := make(map[string]image.Point)
@@ -537,7 +879,9 @@ func packTextures(images map[string]image.Image) *AtlasResult {
 	}
 }
 
-func saveAsKTX2(img image.Image, outputPath, compression string, quality int) bool {
+// saveAsKTX2 runs an image through toktx. Data that isn't color (normals, roughness) is linear
+// and has to be flagged as such or it gets gamma mangled.
+func saveAsKTX2(img image.Image, outputPath, compression string, quality int, linear bool) bool {
 	// Create temporary PNG using imgconv
 	tmpFile, err := os.CreateTemp("", "*.png")
 	if err != nil {
@@ -557,6 +901,12 @@ func saveAsKTX2(img image.Image, outputPath, compression string, quality int) bo
 
 	// Build toktx command
 	args := []string{"--t2", "--genmipmap"}
+	if linear {
+		args = append(args, "--assign_oetf", "linear")
+	} else {
+		// Faces are all sRGB by now (see processImageWithVips), say so instead of leaving toktx to guess
+		args = append(args, "--assign_oetf", "srgb", "--assign_primaries", "bt709")
+	}
 
 	if compression == "etc1s" {
 		args = append(args, "--encode", "etc1s", "--clevel", "1", "--qlevel", fmt.Sprintf("%d", quality))
@@ -579,7 +929,9 @@ func saveAsKTX2(img image.Image, outputPath, compression string, quality int) bo
 	return true
 }
 
-func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode GatefoldMode, topWidth *float32) []*MeshPart {
+func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode GatefoldMode, topWidth *float32, detail MeshDetail) []*MeshPart {
+	boxType := resolveBoxType(gameInfo)
+
 	w := gameInfo.Width / 2.0
 	h := gameInfo.Height / 2.0
 	d := gameInfo.Depth / 2.0
@@ -710,36 +1062,17 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		return [][2]float32{{u0, v0}, {u1, v0}, {u1, v1}, {u0, v1}}
 	}
 
-	// Helper to add a quad specifically targeting a MeshPart
-	addQuad := func(mesh *MeshPart, verts [][3]float32, uvCoords [][2]float32, normal [3]float32) {
-		baseIdx := uint16(len(mesh.Positions))
-		for _, v := range verts {
-			mesh.Positions = append(mesh.Positions, v)
-			mesh.Normals = append(mesh.Normals, normal)
-		}
-		for _, uv := range uvCoords {
-			mesh.UVs = append(mesh.UVs, uv)
+	// edgeTex picks the texture for the edge of a flap, plain cardboard if we have it
+	edgeTex := func(side string) string {
+		if detail.Cardboard {
+			return "cardboard"
 		}
-		mesh.Indices = append(mesh.Indices, baseIdx, baseIdx+1, baseIdx+2)
-		mesh.Indices = append(mesh.Indices, baseIdx, baseIdx+2, baseIdx+3)
-	}
-
-	// Helper to add a triangle specifically targeting a MeshPart
-	addTri := func(mesh *MeshPart, verts [][3]float32, uvCoords [][2]float32, normal [3]float32) {
-		baseIdx := uint16(len(mesh.Positions))
-		for _, v := range verts {
-			mesh.Positions = append(mesh.Positions, v)
-			mesh.Normals = append(mesh.Normals, normal)
-		}
-		for _, uv := range uvCoords {
-			mesh.UVs = append(mesh.UVs, uv)
-		}
-		mesh.Indices = append(mesh.Indices, baseIdx, baseIdx+1, baseIdx+2)
+		return side
 	}
 
 	// addGatefoldPanel generates a full 6-face panel (front, back, top, bottom, left, right)
 	// for a gatefold flap. frontTex/backTex are the atlas keys for the unique faces;
-	// edges reuse the main box textures.
+	// edges reuse the main box textures, or cardboard when the detail asks for it.
 	addGatefoldPanel := func(mesh *MeshPart, verts [][3]float32, frontTex, backTex string,
 		frontNormal, backNormal [3]float32, trapRatio *float32,
 		flipBack bool, flipVert *bool, backRotation int) {
@@ -769,7 +1102,7 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		}
 
 		// Top face (reuse box top texture)
-		uvTop := addUVSet("top", nil, false, false, nil, 0)
+		uvTop := addUVSet(edgeTex("top"), nil, false, false, nil, 0)
 		if isTrapezoid {
 			addTri(mesh, [][3]float32{verts[3], verts[2], verts[6]},
 				[][2]float32{uvTop[0], uvTop[1], uvTop[2]}, [3]float32{0, 1, 0})
@@ -781,7 +1114,7 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		}
 
 		// Bottom face (reuse box bottom texture)
-		uvBot := addUVSet("bottom", nil, false, false, nil, 0)
+		uvBot := addUVSet(edgeTex("bottom"), nil, false, false, nil, 0)
 		if isTrapezoid {
 			addTri(mesh, [][3]float32{verts[1], verts[5], verts[4]},
 				[][2]float32{uvBot[2], uvBot[3], uvBot[0]}, [3]float32{0, -1, 0})
@@ -793,7 +1126,7 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		}
 
 		// Right edge (reuse box right texture)
-		uvRight := addUVSet("right", nil, false, false, nil, 0)
+		uvRight := addUVSet(edgeTex("right"), nil, false, false, nil, 0)
 		if isTrapezoid {
 			addTri(mesh, [][3]float32{verts[1], verts[5], verts[6]},
 				[][2]float32{uvRight[0], uvRight[1], uvRight[2]}, [3]float32{1, 0, 0})
@@ -805,7 +1138,7 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		}
 
 		// Left edge (reuse box left texture)
-		uvLeft := addUVSet("left", nil, false, false, nil, 0)
+		uvLeft := addUVSet(edgeTex("left"), nil, false, false, nil, 0)
 		if isTrapezoid {
 			addTri(mesh, [][3]float32{verts[4], verts[0], verts[3]},
 				[][2]float32{uvLeft[0], uvLeft[1], uvLeft[2]}, [3]float32{-1, 0, 0})
@@ -817,115 +1150,178 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		}
 	}
 
-	// Generate Box Geometry
-	// Front face
-	uvF := addUVSet("front", trapRatio, false, false, nil, 0)
-	if gameInfo.BoxType == models.FindBoxTypeIDByName("Big Box With Vertical Gatefold But Horizontal") {
-		uvF = addUVSet("front", trapRatio, false, false, nil, 90)
+	// Cases aren't boxes with faces, they get their own models
+	faceUVs := func(name string) [][2]float32 {
+		return addUVSet(name, nil, false, false, nil, 0)
 	}
-	if isTrapezoid {
-		addTri(boxMesh, [][3]float32{boxVerts[0], boxVerts[1], boxVerts[2]},
-			[][2]float32{uvF[0], uvF[1], uvF[2]}, [3]float32{0, 0, 1})
-		addTri(boxMesh, [][3]float32{boxVerts[0], boxVerts[2], boxVerts[3]},
-			[][2]float32{uvF[0], uvF[2], uvF[3]}, [3]float32{0, 0, 1})
-	} else {
-		addQuad(boxMesh, [][3]float32{boxVerts[0], boxVerts[1], boxVerts[2], boxVerts[3]},
-			uvF, [3]float32{0, 0, 1})
+	switch boxType.Shape {
+	case models.BoxShapeJewelCase:
+		return generateJewelCaseGeometry(gameInfo, faceUVs)
+	case models.BoxShapeKeepCase:
+		return generateKeepCaseGeometry(gameInfo, faceUVs)
 	}
 
-	// Back face
+	// Generate Box Geometry
+	uvF := addUVSet("front", trapRatio, false, false, nil, boxType.FaceRotation)
 	uvBk := addUVSet("back", trapRatio, false, false, nil, 0)
-	if isTrapezoid {
-		addTri(boxMesh, [][3]float32{boxVerts[5], boxVerts[4], boxVerts[7]},
-			[][2]float32{uvBk[0], uvBk[1], uvBk[2]}, [3]float32{0, 0, -1})
-		addTri(boxMesh, [][3]float32{boxVerts[5], boxVerts[7], boxVerts[6]},
-			[][2]float32{uvBk[0], uvBk[2], uvBk[3]}, [3]float32{0, 0, -1})
-	} else {
-		addQuad(boxMesh, [][3]float32{boxVerts[5], boxVerts[4], boxVerts[7], boxVerts[6]},
-			uvBk, [3]float32{0, 0, -1})
-	}
-
-	// Right face
 	uvR := addUVSet("right", nil, false, false, nil, 0)
-	if isTrapezoid {
-		addTri(boxMesh, [][3]float32{boxVerts[1], boxVerts[5], boxVerts[6]},
-			[][2]float32{uvR[0], uvR[1], uvR[2]}, [3]float32{1, 0, 0})
-		addTri(boxMesh, [][3]float32{boxVerts[1], boxVerts[6], boxVerts[2]},
-			[][2]float32{uvR[0], uvR[2], uvR[3]}, [3]float32{1, 0, 0})
-	} else {
-		addQuad(boxMesh, [][3]float32{boxVerts[1], boxVerts[5], boxVerts[6], boxVerts[2]},
-			uvR, [3]float32{1, 0, 0})
-	}
-
-	// Left face
 	uvL := addUVSet("left", nil, false, false, nil, 0)
-	if isTrapezoid {
-		addTri(boxMesh, [][3]float32{boxVerts[4], boxVerts[0], boxVerts[3]},
-			[][2]float32{uvL[0], uvL[1], uvL[2]}, [3]float32{-1, 0, 0})
-		addTri(boxMesh, [][3]float32{boxVerts[4], boxVerts[3], boxVerts[7]},
-			[][2]float32{uvL[0], uvL[2], uvL[3]}, [3]float32{-1, 0, 0})
+	uvT := addUVSet("top", nil, false, false, nil, 0)
+	uvB := addUVSet("bottom", nil, false, false, nil, 0)
+
+	// Rounded edges only make sense on a plain cuboid, trapezoids keep their sharp corners
+	if r := clampBevel(detail.BevelRadius, [3]float32{w, h, d}); r > 0 && !isTrapezoid {
+		addBeveledBox(boxMesh, [3]float32{w, h, d}, r, detail.BevelSegments, []bevelFace{
+			{Corners: [4][3]float32{boxVerts[0], boxVerts[1], boxVerts[2], boxVerts[3]}, UVs: uvF, Normal: [3]float32{0, 0, 1}},
+			{Corners: [4][3]float32{boxVerts[5], boxVerts[4], boxVerts[7], boxVerts[6]}, UVs: uvBk, Normal: [3]float32{0, 0, -1}},
+			{Corners: [4][3]float32{boxVerts[1], boxVerts[5], boxVerts[6], boxVerts[2]}, UVs: uvR, Normal: [3]float32{1, 0, 0}},
+			{Corners: [4][3]float32{boxVerts[4], boxVerts[0], boxVerts[3], boxVerts[7]}, UVs: uvL, Normal: [3]float32{-1, 0, 0}},
+			{Corners: [4][3]float32{boxVerts[3], boxVerts[2], boxVerts[6], boxVerts[7]}, UVs: uvT, Normal: [3]float32{0, 1, 0}},
+			{Corners: [4][3]float32{boxVerts[4], boxVerts[5], boxVerts[1], boxVerts[0]}, UVs: uvB, Normal: [3]float32{0, -1, 0}},
+		})
 	} else {
-		addQuad(boxMesh, [][3]float32{boxVerts[4], boxVerts[0], boxVerts[3], boxVerts[7]},
-			uvL, [3]float32{-1, 0, 0})
-	}
+		// Front face
+		if isTrapezoid {
+			addTri(boxMesh, [][3]float32{boxVerts[0], boxVerts[1], boxVerts[2]},
+				[][2]float32{uvF[0], uvF[1], uvF[2]}, [3]float32{0, 0, 1})
+			addTri(boxMesh, [][3]float32{boxVerts[0], boxVerts[2], boxVerts[3]},
+				[][2]float32{uvF[0], uvF[2], uvF[3]}, [3]float32{0, 0, 1})
+		} else {
+			addQuad(boxMesh, [][3]float32{boxVerts[0], boxVerts[1], boxVerts[2], boxVerts[3]},
+				uvF, [3]float32{0, 0, 1})
+		}
 
-	// Top face
-	uvT := addUVSet("top", nil, false, false, nil, 0)
-	addQuad(boxMesh, [][3]float32{boxVerts[3], boxVerts[2], boxVerts[6], boxVerts[7]},
-		uvT, [3]float32{0, 1, 0})
+		// Back face
+		if isTrapezoid {
+			addTri(boxMesh, [][3]float32{boxVerts[5], boxVerts[4], boxVerts[7]},
+				[][2]float32{uvBk[0], uvBk[1], uvBk[2]}, [3]float32{0, 0, -1})
+			addTri(boxMesh, [][3]float32{boxVerts[5], boxVerts[7], boxVerts[6]},
+				[][2]float32{uvBk[0], uvBk[2], uvBk[3]}, [3]float32{0, 0, -1})
+		} else {
+			addQuad(boxMesh, [][3]float32{boxVerts[5], boxVerts[4], boxVerts[7], boxVerts[6]},
+				uvBk, [3]float32{0, 0, -1})
+		}
 
-	// Bottom face
-	uvB := addUVSet("bottom", nil, false, false, nil, 0)
-	addQuad(boxMesh, [][3]float32{boxVerts[4], boxVerts[5], boxVerts[1], boxVerts[0]},
-		uvB, [3]float32{0, -1, 0})
+		// Right face
+		if isTrapezoid {
+			addTri(boxMesh, [][3]float32{boxVerts[1], boxVerts[5], boxVerts[6]},
+				[][2]float32{uvR[0], uvR[1], uvR[2]}, [3]float32{1, 0, 0})
+			addTri(boxMesh, [][3]float32{boxVerts[1], boxVerts[6], boxVerts[2]},
+				[][2]float32{uvR[0], uvR[2], uvR[3]}, [3]float32{1, 0, 0})
+		} else {
+			addQuad(boxMesh, [][3]float32{boxVerts[1], boxVerts[5], boxVerts[6], boxVerts[2]},
+				uvR, [3]float32{1, 0, 0})
+		}
+
+		// Left face
+		if isTrapezoid {
+			addTri(boxMesh, [][3]float32{boxVerts[4], boxVerts[0], boxVerts[3]},
+				[][2]float32{uvL[0], uvL[1], uvL[2]}, [3]float32{-1, 0, 0})
+			addTri(boxMesh, [][3]float32{boxVerts[4], boxVerts[3], boxVerts[7]},
+				[][2]float32{uvL[0], uvL[2], uvL[3]}, [3]float32{-1, 0, 0})
+		} else {
+			addQuad(boxMesh, [][3]float32{boxVerts[4], boxVerts[0], boxVerts[3], boxVerts[7]},
+				uvL, [3]float32{-1, 0, 0})
+		}
+
+		// Top face
+		addQuad(boxMesh, [][3]float32{boxVerts[3], boxVerts[2], boxVerts[6], boxVerts[7]},
+			uvT, [3]float32{0, 1, 0})
+
+		// Bottom face
+		addQuad(boxMesh, [][3]float32{boxVerts[4], boxVerts[5], boxVerts[1], boxVerts[0]},
+			uvB, [3]float32{0, -1, 0})
+	}
 
 	// ========================
 	// Gatefold geometry
 	// ========================
 	gfD := d * GatefoldDepthOffset
+	if detail.Cardboard {
+		gfD = CardboardThickness
+	}
+
+	// frontFlapVerts builds a full-width flap over the front face between two depths, outer face first
+	frontFlapVerts := func(zBack, zFront float32) [][3]float32 {
+		return [][3]float32{
+			{-w, -h, zFront},
+			{w, -h, zFront},
+			{topW, h, zFront},
+			{-topW, h, zFront},
+			{-w, -h, zBack},
+			{w, -h, zBack},
+			{topW, h, zBack},
+			{-topW, h, zBack},
+		}
+	}
+
+	// frontHingePivot returns a point on the edge a front flap at depth z swings from
+	frontHingePivot := func(hinge string, z float32) [3]float32 {
+		switch hinge {
+		case models.HingeRight:
+			return [3]float32{w, 0, z}
+		case models.HingeTop:
+			return [3]float32{0, h, z}
+		}
+		return [3]float32{-w, 0, z}
+	}
 
 	switch gatefoldMode {
 	case GatefoldSingleFront:
 		// Single full-width flap on front — node name: "GatefoldFront"
-		gfMesh := &MeshPart{Name: "GatefoldFront"}
+		gfMesh := &MeshPart{Name: "GatefoldFront", Hinge: boxType.GatefoldHinge, Pivot: frontHingePivot(boxType.GatefoldHinge, d)}
 		parts = append(parts, gfMesh)
 
-		gfZ := d
-		gfOffset := gfD
-		gfVerts := [][3]float32{
-			{float32(-w), float32(-h), float32(gfZ + gfOffset)},
-			{float32(w), float32(-h), float32(gfZ + gfOffset)},
-			{float32(topW), float32(h), float32(gfZ + gfOffset)},
-			{float32(-topW), float32(h), float32(gfZ + gfOffset)},
-			{float32(-w), float32(-h), float32(gfZ)},
-			{float32(w), float32(-h), float32(gfZ)},
-			{float32(topW), float32(h), float32(gfZ)},
-			{float32(-topW), float32(h), float32(gfZ)},
-		}
+		gfVerts := frontFlapVerts(d, d+gfD)
 
 		// Determine back face flip/rotation based on box type
-		flipBack := false
-		var flipVert *bool
-		backRotation := 0
-
-		if gameInfo.BoxType == models.FindBoxTypeIDByName("Eidos Trapezoid") || gameInfo.BoxType == models.FindBoxTypeIDByName("Small Box With Vertical Gatefold") {
-			flipBack = true
-			f := false
-			flipVert = &f
-		} else if gameInfo.BoxType == models.FindBoxTypeIDByName("Big Box With Vertical Gatefold But Horizontal") {
-			backRotation = -90
-		} else {
-			flipBack = isTrapezoid
-		}
+		flipBack, flipVert, backRotation := gatefoldBackOrientation(boxType, boxType.GatefoldHinge, isTrapezoid)
 
 		addGatefoldPanel(gfMesh, gfVerts,
 			"gatefold_front_inner", "gatefold_front_back",
 			[3]float32{0, 0, 1}, [3]float32{0, 0, -1},
 			trapRatio, flipBack, flipVert, backRotation)
 
+	case GatefoldTrifoldFront, GatefoldDoublePanelFront:
+		// Two full-width flaps stacked on the front — node names: "GatefoldFront", "GatefoldFrontInner"
+		// The outer flap opens first, then the inner one opens the other way (tri-fold)
+		// or the same way (double panel), leaving the box front as the last page.
+		outerHinge := boxType.GatefoldHinge
+		innerHinge := outerHinge
+		if gatefoldMode == GatefoldTrifoldFront {
+			innerHinge = oppositeHinge(outerHinge)
+		}
+
+		// Each flap swings around the front of its own slab, which puts a double panel's inner flap
+		// behind the outer one once both are open on the same side. Trading hinge depths mirrors them
+		// the other way round so the page opened last ends up on top.
+		outerPivot, innerPivot := d+gfD, d
+		if gatefoldMode == GatefoldDoublePanelFront {
+			outerPivot, innerPivot = d, d+gfD
+		}
+
+		gfOuterMesh := &MeshPart{Name: "GatefoldFront", Hinge: outerHinge, Pivot: frontHingePivot(outerHinge, outerPivot)}
+		parts = append(parts, gfOuterMesh)
+
+		flipBack, flipVert, backRotation := gatefoldBackOrientation(boxType, outerHinge, isTrapezoid)
+		addGatefoldPanel(gfOuterMesh, frontFlapVerts(d+gfD, d+2*gfD),
+			"gatefold_front_inner", "gatefold_front_back",
+			[3]float32{0, 0, 1}, [3]float32{0, 0, -1},
+			trapRatio, flipBack, flipVert, backRotation)
+
+		gfInnerMesh := &MeshPart{Name: "GatefoldFrontInner", Hinge: innerHinge, Pivot: frontHingePivot(innerHinge, innerPivot), OpenStep: 1}
+		parts = append(parts, gfInnerMesh)
+
+		flipBack, flipVert, backRotation = gatefoldBackOrientation(boxType, innerHinge, isTrapezoid)
+		addGatefoldPanel(gfInnerMesh, frontFlapVerts(d, d+gfD),
+			"gatefold_inner_front", "gatefold_inner_back",
+			[3]float32{0, 0, 1}, [3]float32{0, 0, -1},
+			trapRatio, flipBack, flipVert, backRotation)
+
 	case GatefoldSingleBack:
 		// Single full-width flap on back — node name: "GatefoldBack"
-		gfMesh := &MeshPart{Name: "GatefoldBack"}
+		// Back flaps hinge on their own left edge, which is the box's right side
+		gfMesh := &MeshPart{Name: "GatefoldBack", Hinge: models.HingeLeft, Pivot: [3]float32{w, 0, -d}}
 		parts = append(parts, gfMesh)
 
 		gfZ := -d
@@ -957,18 +1353,18 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 		gfOffset := gfD
 
 		// --- Left flap ---
-		gfLeftMesh := &MeshPart{Name: "GatefoldFrontLeft"}
+		gfLeftMesh := &MeshPart{Name: "GatefoldFrontLeft", Hinge: models.HingeLeft, Pivot: frontHingePivot(models.HingeLeft, d)}
 		parts = append(parts, gfLeftMesh)
 
 		gfLeftVerts := [][3]float32{
-			{float32(-w), float32(-h), float32(gfZ + gfOffset)},      // 0: bottom-left front
-			{float32(0), float32(-h), float32(gfZ + gfOffset)},       // 1: bottom-center front
-			{float32(0), float32(h), float32(gfZ + gfOffset)},        // 2: top-center front
-			{float32(-topW), float32(h), float32(gfZ + gfOffset)},    // 3: top-left front
-			{float32(-w), float32(-h), float32(gfZ)},                 // 4: bottom-left back
-			{float32(0), float32(-h), float32(gfZ)},                  // 5: bottom-center back
-			{float32(0), float32(h), float32(gfZ)},                   // 6: top-center back
-			{float32(-topW), float32(h), float32(gfZ)},               // 7: top-left back
+			{float32(-w), float32(-h), float32(gfZ + gfOffset)},   // 0: bottom-left front
+			{float32(0), float32(-h), float32(gfZ + gfOffset)},    // 1: bottom-center front
+			{float32(0), float32(h), float32(gfZ + gfOffset)},     // 2: top-center front
+			{float32(-topW), float32(h), float32(gfZ + gfOffset)}, // 3: top-left front
+			{float32(-w), float32(-h), float32(gfZ)},              // 4: bottom-left back
+			{float32(0), float32(-h), float32(gfZ)},               // 5: bottom-center back
+			{float32(0), float32(h), float32(gfZ)},                // 6: top-center back
+			{float32(-topW), float32(h), float32(gfZ)},            // 7: top-left back
 		}
 
 		addGatefoldPanel(gfLeftMesh, gfLeftVerts,
@@ -977,18 +1373,18 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 			trapRatio, false, nil, 0)
 
 		// --- Right flap ---
-		gfRightMesh := &MeshPart{Name: "GatefoldFrontRight"}
+		gfRightMesh := &MeshPart{Name: "GatefoldFrontRight", Hinge: models.HingeRight, Pivot: frontHingePivot(models.HingeRight, d)}
 		parts = append(parts, gfRightMesh)
 
 		gfRightVerts := [][3]float32{
-			{float32(0), float32(-h), float32(gfZ + gfOffset)},       // 0: bottom-center front
-			{float32(w), float32(-h), float32(gfZ + gfOffset)},       // 1: bottom-right front
-			{float32(topW), float32(h), float32(gfZ + gfOffset)},     // 2: top-right front
-			{float32(0), float32(h), float32(gfZ + gfOffset)},        // 3: top-center front
-			{float32(0), float32(-h), float32(gfZ)},                  // 4: bottom-center back
-			{float32(w), float32(-h), float32(gfZ)},                  // 5: bottom-right back
-			{float32(topW), float32(h), float32(gfZ)},                // 6: top-right back
-			{float32(0), float32(h), float32(gfZ)},                   // 7: top-center back
+			{float32(0), float32(-h), float32(gfZ + gfOffset)},   // 0: bottom-center front
+			{float32(w), float32(-h), float32(gfZ + gfOffset)},   // 1: bottom-right front
+			{float32(topW), float32(h), float32(gfZ + gfOffset)}, // 2: top-right front
+			{float32(0), float32(h), float32(gfZ + gfOffset)},    // 3: top-center front
+			{float32(0), float32(-h), float32(gfZ)},              // 4: bottom-center back
+			{float32(w), float32(-h), float32(gfZ)},              // 5: bottom-right back
+			{float32(topW), float32(h), float32(gfZ)},            // 6: top-right back
+			{float32(0), float32(h), float32(gfZ)},               // 7: top-center back
 		}
 
 		addGatefoldPanel(gfRightMesh, gfRightVerts,
@@ -998,34 +1394,13 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 
 	case GatefoldFrontAndBack:
 		// Full-width flap on front — node name: "GatefoldFront"
-		gfFrontMesh := &MeshPart{Name: "GatefoldFront"}
+		gfFrontMesh := &MeshPart{Name: "GatefoldFront", Hinge: boxType.GatefoldHinge, Pivot: frontHingePivot(boxType.GatefoldHinge, d)}
 		parts = append(parts, gfFrontMesh)
 
-		gfZ := d
-		gfOffset := gfD
-		gfFrontVerts := [][3]float32{
-			{float32(-w), float32(-h), float32(gfZ + gfOffset)},
-			{float32(w), float32(-h), float32(gfZ + gfOffset)},
-			{float32(topW), float32(h), float32(gfZ + gfOffset)},
-			{float32(-topW), float32(h), float32(gfZ + gfOffset)},
-			{float32(-w), float32(-h), float32(gfZ)},
-			{float32(w), float32(-h), float32(gfZ)},
-			{float32(topW), float32(h), float32(gfZ)},
-			{float32(-topW), float32(h), float32(gfZ)},
-		}
+		gfFrontVerts := frontFlapVerts(d, d+gfD)
 
 		// Determine front flap back face flip/rotation based on box type
-		flipFrontBack := false
-		var flipFrontVert *bool
-		frontBackRotation := 0
-
-		if gameInfo.BoxType == models.FindBoxTypeIDByName("Eidos Trapezoid") || gameInfo.BoxType == models.FindBoxTypeIDByName("Small Box With Vertical Gatefold") {
-			flipFrontBack = true
-			f := false
-			flipFrontVert = &f
-		} else {
-			flipFrontBack = isTrapezoid
-		}
+		flipFrontBack, flipFrontVert, frontBackRotation := gatefoldBackOrientation(boxType, boxType.GatefoldHinge, isTrapezoid)
 
 		addGatefoldPanel(gfFrontMesh, gfFrontVerts,
 			"gatefold_front_inner", "gatefold_front_back",
@@ -1033,7 +1408,7 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 			trapRatio, flipFrontBack, flipFrontVert, frontBackRotation)
 
 		// Full-width flap on back — node name: "GatefoldBack"
-		gfBackMesh := &MeshPart{Name: "GatefoldBack"}
+		gfBackMesh := &MeshPart{Name: "GatefoldBack", Hinge: models.HingeLeft, Pivot: [3]float32{w, 0, -d}}
 		parts = append(parts, gfBackMesh)
 
 		gfBackZ := -d
@@ -1055,9 +1430,44 @@ func generateGeometry(gameInfo *GameInfo, atlas *AtlasResult, gatefoldMode Gatef
 			trapRatio, false, nil, 0)
 	}
 
+	if gameInfo.GatefoldTransparent {
+		for _, part := range parts {
+			if part.Hinge != "" {
+				part.Material = MaterialAtlasBlend
+			}
+		}
+	}
+
 	return parts
 }
 
+// addQuad adds a quad specifically targeting a MeshPart
+func addQuad(mesh *MeshPart, verts [][3]float32, uvCoords [][2]float32, normal [3]float32) {
+	baseIdx := uint16(len(mesh.Positions))
+	for _, v := range verts {
+		mesh.Positions = append(mesh.Positions, v)
+		mesh.Normals = append(mesh.Normals, normal)
+	}
+	for _, uv := range uvCoords {
+		mesh.UVs = append(mesh.UVs, uv)
+	}
+	mesh.Indices = append(mesh.Indices, baseIdx, baseIdx+1, baseIdx+2)
+	mesh.Indices = append(mesh.Indices, baseIdx, baseIdx+2, baseIdx+3)
+}
+
+// addTri adds a triangle specifically targeting a MeshPart
+func addTri(mesh *MeshPart, verts [][3]float32, uvCoords [][2]float32, normal [3]float32) {
+	baseIdx := uint16(len(mesh.Positions))
+	for _, v := range verts {
+		mesh.Positions = append(mesh.Positions, v)
+		mesh.Normals = append(mesh.Normals, normal)
+	}
+	for _, uv := range uvCoords {
+		mesh.UVs = append(mesh.UVs, uv)
+	}
+	mesh.Indices = append(mesh.Indices, baseIdx, baseIdx+1, baseIdx+2)
+}
+
 func CleanupKTX2Files(webdir string) {
 	filepath.Walk(webdir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -1068,4 +1478,4 @@ func CleanupKTX2Files(webdir string) {
 		}
 		return nil
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+
+	"github.com/adamzwakk/bigboxdb/server/models"
+)
+
+// go test ./tools -run Golden -update
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+const goldenPixelsPerInch = 8 // Synthetic faces only need the right proportions, keep them small
+
+// Standard size for box types that don't have one
+var goldenDefaultSize = [3]float32{7.5, 9.25, 2}
+
+// Atlas keys each gatefold mode packs on top of the six box faces, see GenerateGLTFBox
+var goldenGatefoldFaces = map[GatefoldMode][]string{
+	GatefoldNone:             nil,
+	GatefoldSingleFront:      {"gatefold_front_inner", "gatefold_front_back"},
+	GatefoldSingleBack:       {"gatefold_back_inner", "gatefold_back_back"},
+	GatefoldDoubleFront:      {"gatefold_front_left", "gatefold_front_right", "gatefold_front_left_back", "gatefold_front_right_back"},
+	GatefoldFrontAndBack:     {"gatefold_front_inner", "gatefold_front_back", "gatefold_back_inner", "gatefold_back_back"},
+	GatefoldTrifoldFront:     {"gatefold_front_inner", "gatefold_front_back", "gatefold_inner_front", "gatefold_inner_back"},
+	GatefoldDoublePanelFront: {"gatefold_front_inner", "gatefold_front_back", "gatefold_inner_front", "gatefold_inner_back"},
+}
+
+type goldenCase struct {
+	Name    string
+	BoxType models.BoxType
+	Low     bool
+}
+
+// goldenCases is every seeded box type at both qualities, plus a plain box for any gatefold
+// layout no seeded type uses yet
+func goldenCases() []goldenCase {
+	var cases []goldenCase
+	used := make(map[string]bool)
+	for _, bt := range models.BoxtypesEnum {
+		used[bt.GatefoldLayout] = true
+		for _, low := range []bool{false, true} {
+			cases = append(cases, goldenCase{Name: fmt.Sprintf("type%02d-%s", bt.ID, goldenQuality(low)), BoxType: bt, Low: low})
+		}
+	}
+
+	var layouts []string
+	for layout := range gatefoldLayouts {
+		if !used[layout] {
+			layouts = append(layouts, layout)
+		}
+	}
+	sort.Strings(layouts)
+	for _, layout := range layouts {
+		bt := models.BoxType{Name: layout, Shape: models.BoxShapeCuboid, GatefoldLayout: layout, GatefoldHinge: models.HingeLeft}
+		for _, low := range []bool{false, true} {
+			cases = append(cases, goldenCase{Name: fmt.Sprintf("layout-%s-%s", layout, goldenQuality(low)), BoxType: bt, Low: low})
+		}
+	}
+	return cases
+}
+
+func goldenQuality(low bool) string {
+	if low {
+		return "low"
+	}
+	return "high"
+}
+
+// goldenFaces makes a solid colored image for every atlas key the box needs, sized like the scans would be
+func goldenFaces(size [3]float32, mode GatefoldMode, detail MeshDetail) map[string]image.Image {
+	w, h, d := int(size[0]*goldenPixelsPerInch), int(size[1]*goldenPixelsPerInch), int(size[2]*goldenPixelsPerInch)
+	dims := map[string][2]int{
+		"front": {w, h}, "back": {w, h},
+		"left": {d, h}, "right": {d, h},
+		"top": {w, d}, "bottom": {w, d},
+	}
+	for _, name := range goldenGatefoldFaces[mode] {
+		dims[name] = [2]int{w, h}
+	}
+
+	// Sorted so every face gets the same color each run
+	var names []string
+	for name := range dims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	faces := make(map[string]image.Image)
+	for i, name := range names {
+		c := color.NRGBA{R: uint8(40 + i*17), G: uint8(200 - i*11), B: uint8(i * 23), A: 255}
+		faces[name] = imaging.New(dims[name][0], dims[name][1], c)
+	}
+	if detail.Cardboard {
+		faces["cardboard"] = imaging.New(8, 8, CardboardEdgeColor)
+	}
+	return faces
+}
+
+// buildGolden runs a case through packTextures and generateGeometry the way GenerateGLTFBox does
+func buildGolden(c goldenCase) (*AtlasResult, []*MeshPart) {
+	bt := c.BoxType
+	size := goldenDefaultSize
+	if bt.Width != nil && bt.Height != nil && bt.Depth != nil {
+		size = [3]float32{*bt.Width, *bt.Height, *bt.Depth}
+	}
+
+	gameInfo := &GameInfo{Title: c.Name, Width: size[0], Height: size[1], Depth: size[2], BoxType: bt.ID, BoxTypeDef: &bt}
+
+	var topWidth *float32
+	if bt.Shape == models.BoxShapeTrapezoid && bt.TopWidthRatio != nil {
+		tw := gameInfo.Width * *bt.TopWidthRatio
+		topWidth = &tw
+	}
+
+	// Not meshDetailFor, the env overrides shouldn't change what the goldens expect
+	detail := MeshDetail{}
+	if !c.Low {
+		detail = MeshDetail{BevelRadius: BevelRadius, BevelSegments: BevelSegments, Cardboard: true}
+	}
+
+	mode := determineGatefoldMode(&bt)
+	atlas := packTextures(goldenFaces(size, mode, detail))
+	return atlas, generateGeometry(gameInfo, atlas, mode, topWidth, detail)
+}
+
+// goldenFloat rounds to what's worth diffing and never writes -0
+func goldenFloat(f float32) string {
+	s := strconv.FormatFloat(float64(f), 'f', 5, 32)
+	if strings.Trim(s, "-0.") == "" {
+		return "0"
+	}
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s
+}
+
+func goldenFloats(fs ...float32) string {
+	out := make([]string, len(fs))
+	for i, f := range fs {
+		out[i] = goldenFloat(f)
+	}
+	return "[" + strings.Join(out, ", ") + "]"
+}
+
+// encodeGolden writes the atlas layout and geometry as JSON with one face, vertex or triangle per
+// line, so a change to the geometry shows up as a readable diff
+func encodeGolden(atlas *AtlasResult, parts []*MeshPart) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	fmt.Fprintf(&b, "  \"atlas\": {\n    \"width\": %d,\n    \"height\": %d,\n    \"faces\": {\n", atlas.Dimensions.X, atlas.Dimensions.Y)
+
+	var names []string
+	for name := range atlas.Positions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		pos, size := atlas.Positions[name], atlas.Sizes[name]
+		fmt.Fprintf(&b, "      %q: [%d, %d, %d, %d]%s\n", name, pos.X, pos.Y, size.X, size.Y, goldenComma(i, len(names)))
+	}
+	b.WriteString("    }\n  },\n  \"parts\": [\n")
+
+	for p, part := range parts {
+		b.WriteString("    {\n")
+		fmt.Fprintf(&b, "      \"name\": %q,\n", part.Name)
+		fmt.Fprintf(&b, "      \"material\": %q,\n", part.Material)
+		fmt.Fprintf(&b, "      \"hinge\": %q,\n", part.Hinge)
+		fmt.Fprintf(&b, "      \"pivot\": %s,\n", goldenFloats(part.Pivot[:]...))
+		fmt.Fprintf(&b, "      \"open_step\": %d,\n", part.OpenStep)
+
+		// position, normal, uv
+		b.WriteString("      \"vertices\": [\n")
+		for i, pos := range part.Positions {
+			var n [3]float32
+			var uv [2]float32
+			if i < len(part.Normals) {
+				n = part.Normals[i]
+			}
+			if i < len(part.UVs) {
+				uv = part.UVs[i]
+			}
+			fmt.Fprintf(&b, "        %s%s\n", goldenFloats(pos[0], pos[1], pos[2], n[0], n[1], n[2], uv[0], uv[1]), goldenComma(i, len(part.Positions)))
+		}
+		b.WriteString("      ],\n      \"triangles\": [\n")
+		for i := 0; i+2 < len(part.Indices); i += 3 {
+			fmt.Fprintf(&b, "        [%d, %d, %d]%s\n", part.Indices[i], part.Indices[i+1], part.Indices[i+2], goldenComma(i/3, len(part.Indices)/3))
+		}
+		fmt.Fprintf(&b, "      ]\n    }%s\n", goldenComma(p, len(parts)))
+	}
+	b.WriteString("  ]\n}\n")
+	return b.String()
+}
+
+func goldenComma(i, n int) string {
+	if i < n-1 {
+		return ","
+	}
+	return ""
+}
+
+func TestGoldenGeometry(t *testing.T) {
+	os.Setenv("APP_ENV", "production") // Quiets the packing and missing texture chatter
+
+	for _, c := range goldenCases() {
+		t.Run(c.Name, func(t *testing.T) {
+			atlas, parts := buildGolden(c)
+			for _, part := range parts {
+				if len(part.Normals) != len(part.Positions) || len(part.UVs) != len(part.Positions) {
+					t.Errorf("%s: %d positions, %d normals, %d uvs", part.Name, len(part.Positions), len(part.Normals), len(part.UVs))
+				}
+			}
+
+			got := encodeGolden(atlas, parts)
+			path := filepath.Join("testdata", "golden", c.Name+".json")
+
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("no golden file, run with -update to make one: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("geometry doesn't match %s, run with -update and review the diff if that's expected\n%s", path, firstDiff(string(want), got))
+			}
+		})
+	}
+}
+
+// firstDiff points at the first line that changed, the full picture is in git diff after -update
+func firstDiff(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want %s\n  got  %s", i+1, strings.TrimSpace(w), strings.TrimSpace(g))
+		}
+	}
+	return ""
+}
@@ -1,4 +1,4 @@
-import {useEffect, useRef, useState} from "react";
+import {useEffect, useMemo, useRef, useState} from "react";
 import {useStore} from "@/lib/Store";
 import { useNavigate, useParams } from "react-router";
 import { InstantSearch, SearchBox, Hits, useInstantSearch, useSearchBox, Configure } from 'react-instantsearch';
@@ -8,10 +8,30 @@ export default function Search({onShelf}:{onShelf:boolean})
 {
     const navigate = useNavigate();
 
-    const { searchClient } = instantMeiliSearch(
+    // Short lived tenant token from the API, fetched again a minute before it runs out
+    const [searchToken, setSearchToken] = useState('')
+    useEffect(() => {
+        let timer: ReturnType<typeof setTimeout>
+        const refresh = () => {
+            fetch('/api/search/token')
+                .then(response => response.json())
+                .then(data => {
+                    setSearchToken(data.token)
+                    const expiresIn = new Date(data.expires_at).getTime() - Date.now()
+                    timer = setTimeout(refresh, Math.max(expiresIn - 60000, 10000))
+                })
+                .catch(() => {
+                    timer = setTimeout(refresh, 30000)
+                })
+        }
+        refresh()
+        return () => clearTimeout(timer)
+    }, [])
+
+    const { searchClient } = useMemo(() => instantMeiliSearch(
         import.meta.env.VITE_MEILI_URL, 
-        import.meta.env.VITE_MEILI_KEY
-    );
+        searchToken
+    ), [searchToken]);
     
     const { setGoToSearchedGame, goToSearchedGame } = useStore();
     const [showSearch, setShowSearch] = useState(true)
@@ -69,7 +89,7 @@ export default function Search({onShelf}:{onShelf:boolean})
     }
     
     return(
-        showSearch && <div id="searchBox" className="relative">
+        showSearch && searchToken !== '' && <div id="searchBox" className="relative">
             <InstantSearch future={{preserveSharedStateOnUnmount:true}} indexName="items" searchClient={searchClient}>
                 <Configure hitsPerPage={5} />
                 <SearchBox 